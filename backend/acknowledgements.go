@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PolicyAcknowledgement model recording that a user read and accepted one version of a policy.
+// The content hash keeps the proof verifiable even after the document changes again.
+type PolicyAcknowledgement struct {
+	ID              uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID          uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_ack_user_document_version"`
+	User            User       `json:"-" gorm:"foreignKey:UserID"`
+	DocumentID      uint       `json:"document_id" gorm:"not null;uniqueIndex:idx_ack_user_document_version;index"`
+	Document        PolicyFile `json:"-" gorm:"foreignKey:DocumentID"`
+	DocumentVersion int        `json:"document_version" gorm:"not null;uniqueIndex:idx_ack_user_document_version"`
+	ContentHash     string     `json:"content_hash" gorm:"not null;size:64"` // SHA-256 of the acknowledged content
+	IPAddress       string     `json:"ip_address,omitempty" gorm:"size:45"`
+	UserAgent       string     `json:"user_agent,omitempty" gorm:"type:text"`
+	AcknowledgedAt  time.Time  `json:"acknowledged_at" gorm:"autoCreateTime;index"`
+}
+
+// Acknowledgement states of a policy for a user
+const (
+	AckStatusAcknowledged = "acknowledged" // Current version accepted
+	AckStatusOutdated     = "outdated"     // An earlier version was accepted, re-attestation required
+	AckStatusPending      = "pending"      // Never accepted
+)
+
+// Request structure for attesting to a policy
+type AcknowledgeRequest struct {
+	Version int `json:"version" binding:"required"` // Version the user read, must be the current one
+}
+
+// PolicyAcknowledgementStatus is a user's standing for one policy
+type PolicyAcknowledgementStatus struct {
+	DocumentID     uint       `json:"document_id"`
+	DocumentName   string     `json:"document_name"`
+	Category       string     `json:"category"`
+	CurrentVersion int        `json:"current_version"`
+	Status         string     `json:"status"`
+	AckedVersion   int        `json:"acknowledged_version,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+}
+
+// AcknowledgementUser is one row of the admin report
+type AcknowledgementUser struct {
+	UserInfo
+	Status         string     `json:"status"`
+	AckedVersion   int        `json:"acknowledged_version,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+}
+
+// PolicyAcknowledgementReport lists who has and hasn't accepted the current version of a policy
+type PolicyAcknowledgementReport struct {
+	DocumentID     uint                  `json:"document_id"`
+	DocumentName   string                `json:"document_name"`
+	CurrentVersion int                   `json:"current_version"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+	Acknowledged   []AcknowledgementUser `json:"acknowledged"`
+	Outstanding    []AcknowledgementUser `json:"outstanding"` // Pending or outdated
+	TotalUsers     int                   `json:"total_users"`
+	Completion     float64               `json:"completion"` // Share of users on the current version, 0-1
+}
+
+// Policies that compliance requires every employee to accept
+var defaultAcknowledgementPolicies = []string{
+	"Password Policy",
+	"Data Classification Policy",
+	"Remote Work Security Policy",
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Flag the compliance policies on databases seeded before acknowledgements existed
+func seedAcknowledgementPolicies() error {
+	var flagged int64
+	if err := db.Model(&PolicyFile{}).Where("requires_acknowledgement = ?", true).Count(&flagged).Error; err != nil {
+		return err
+	}
+	if flagged > 0 {
+		return nil
+	}
+
+	result := db.Model(&PolicyFile{}).Where("name IN ?", defaultAcknowledgementPolicies).Update("requires_acknowledgement", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to flag policies for acknowledgement: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Flagged %d policies as requiring acknowledgement", result.RowsAffected)
+	}
+	return nil
+}
+
+// Active policies employees must acknowledge
+func acknowledgementPolicies(documentID string) ([]PolicyFile, error) {
+	query := db.Where("requires_acknowledgement = ? AND is_active = ?", true, true)
+	if documentID != "" {
+		query = query.Where("id = ?", documentID)
+	}
+	var documents []PolicyFile
+	err := query.Order("name ASC").Find(&documents).Error
+	return documents, err
+}
+
+// Latest acknowledgement per user and document
+func latestAcknowledgements(query *gorm.DB) (map[uint]map[uint]PolicyAcknowledgement, error) {
+	var acknowledgements []PolicyAcknowledgement
+	if err := query.Order("document_version ASC").Find(&acknowledgements).Error; err != nil {
+		return nil, err
+	}
+
+	latest := make(map[uint]map[uint]PolicyAcknowledgement)
+	for _, ack := range acknowledgements {
+		if latest[ack.UserID] == nil {
+			latest[ack.UserID] = make(map[uint]PolicyAcknowledgement)
+		}
+		latest[ack.UserID][ack.DocumentID] = ack
+	}
+	return latest, nil
+}
+
+// Status of a policy given the user's latest acknowledgement, if any
+func acknowledgementStatus(document PolicyFile, ack *PolicyAcknowledgement) (string, int, *time.Time) {
+	if ack == nil {
+		return AckStatusPending, 0, nil
+	}
+	acknowledgedAt := ack.AcknowledgedAt
+	if ack.DocumentVersion >= document.Version {
+		return AckStatusAcknowledged, ack.DocumentVersion, &acknowledgedAt
+	}
+	return AckStatusOutdated, ack.DocumentVersion, &acknowledgedAt
+}
+
+// Acknowledgement handlers
+
+// List the policies the current user must acknowledge and their status
+func handleGetMyAcknowledgements(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	documents, err := acknowledgementPolicies("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch policies"})
+		return
+	}
+	latest, err := latestAcknowledgements(db.Where("user_id = ?", userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch acknowledgements"})
+		return
+	}
+
+	statuses := make([]PolicyAcknowledgementStatus, 0, len(documents))
+	outstanding := 0
+	for _, document := range documents {
+		var ack *PolicyAcknowledgement
+		if userAcks, exists := latest[userID.(uint)]; exists {
+			if found, exists := userAcks[document.ID]; exists {
+				ack = &found
+			}
+		}
+		status, version, acknowledgedAt := acknowledgementStatus(document, ack)
+		if status != AckStatusAcknowledged {
+			outstanding++
+		}
+		statuses = append(statuses, PolicyAcknowledgementStatus{
+			DocumentID:     document.ID,
+			DocumentName:   document.Name,
+			Category:       document.Category,
+			CurrentVersion: document.Version,
+			Status:         status,
+			AckedVersion:   version,
+			AcknowledgedAt: acknowledgedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies":    statuses,
+		"outstanding": outstanding,
+	})
+}
+
+// Attest that the current user read and accepts the current version of a policy
+func handleAcknowledgePolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	var req AcknowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var document PolicyFile
+	if err := db.Where("is_active = ?", true).First(&document, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		}
+		return
+	}
+	if !document.RequiresAcknowledgement {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This document does not require acknowledgement"})
+		return
+	}
+	// Accepting a version the user did not read would not be valid proof
+	if req.Version != document.Version {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":           "The policy has changed since you opened it. Please read the current version before acknowledging.",
+			"current_version": document.Version,
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uint)
+
+	ack := PolicyAcknowledgement{
+		UserID:          uid,
+		DocumentID:      document.ID,
+		DocumentVersion: document.Version,
+		ContentHash:     contentHash(document.Content),
+		IPAddress:       c.ClientIP(),
+		UserAgent:       c.GetHeader("User-Agent"),
+	}
+	result := db.Where("user_id = ? AND document_id = ? AND document_version = ?", uid, document.ID, document.Version).FirstOrCreate(&ack)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record acknowledgement"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusOK, ack) // Already acknowledged
+		return
+	}
+
+	logAuditActivity(c, uid, ActionCreate, ResourceAcknowledgement, &document.ID, document.Name,
+		fmt.Sprintf("Acknowledged %s version %d (sha256 %s)", document.Name, document.Version, ack.ContentHash[:12]))
+
+	c.JSON(http.StatusCreated, ack)
+}
+
+// Who has and hasn't acknowledged each active policy (Admin only).
+// Filter with document_id, and with status=outstanding to list only users still to attest.
+func handleGetAcknowledgementReport(c *gin.Context) {
+	documents, err := acknowledgementPolicies(c.Query("document_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch policies"})
+		return
+	}
+
+	var users []User
+	if err := db.Where("is_active = ?", true).Order("last_name ASC, first_name ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	documentIDs := make([]uint, 0, len(documents))
+	for _, document := range documents {
+		documentIDs = append(documentIDs, document.ID)
+	}
+	latest, err := latestAcknowledgements(db.Where("document_id IN ?", documentIDs))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch acknowledgements"})
+		return
+	}
+
+	outstandingOnly := c.Query("status") == "outstanding"
+	reports := make([]PolicyAcknowledgementReport, 0, len(documents))
+	for _, document := range documents {
+		report := PolicyAcknowledgementReport{
+			DocumentID:     document.ID,
+			DocumentName:   document.Name,
+			CurrentVersion: document.Version,
+			UpdatedAt:      document.UpdatedAt,
+			Acknowledged:   []AcknowledgementUser{},
+			Outstanding:    []AcknowledgementUser{},
+			TotalUsers:     len(users),
+		}
+
+		for _, user := range users {
+			var ack *PolicyAcknowledgement
+			if found, exists := latest[user.ID][document.ID]; exists {
+				ack = &found
+			}
+			status, version, acknowledgedAt := acknowledgementStatus(document, ack)
+			entry := AcknowledgementUser{
+				UserInfo:       userToUserInfo(user),
+				Status:         status,
+				AckedVersion:   version,
+				AcknowledgedAt: acknowledgedAt,
+			}
+			if status == AckStatusAcknowledged {
+				report.Acknowledged = append(report.Acknowledged, entry)
+			} else {
+				report.Outstanding = append(report.Outstanding, entry)
+			}
+		}
+
+		if report.TotalUsers > 0 {
+			report.Completion = float64(len(report.Acknowledged)) / float64(report.TotalUsers)
+		}
+		if outstandingOnly {
+			report.Acknowledged = []AcknowledgementUser{}
+		}
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": reports})
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnswerCacheConfig controls the chat answer cache
+type AnswerCacheConfig struct {
+	Enabled    bool
+	TTL        time.Duration
+	MaxEntries int
+	Similarity float64 // Minimum term overlap (Jaccard) for a paraphrase to reuse an answer
+}
+
+func loadAnswerCacheConfig() AnswerCacheConfig {
+	return AnswerCacheConfig{
+		Enabled:    getEnv("ANSWER_CACHE_ENABLED", "true") == "true",
+		TTL:        getEnvDuration("ANSWER_CACHE_TTL", 24*time.Hour),
+		MaxEntries: getEnvInt("ANSWER_CACHE_MAX_ENTRIES", 500),
+		Similarity: float64(getEnvInt("ANSWER_CACHE_SIMILARITY_PERCENT", 80)) / 100,
+	}
+}
+
+// Cached LLM answer for a question over a specific version of the retrieved documents
+type cachedAnswer struct {
+	Question    string
+	Terms       map[string]bool
+	Documents   string
+	DocumentIDs []uint
+	Response    LLMResponse
+	CreatedAt   time.Time
+	Hits        int
+}
+
+// AnswerCacheStats is reported on the admin endpoint
+type AnswerCacheStats struct {
+	Entries       int     `json:"entries"`
+	Hits          int     `json:"hits"`
+	SemanticHits  int     `json:"semantic_hits"` // Hits on a paraphrased question
+	Misses        int     `json:"misses"`
+	HitRate       float64 `json:"hit_rate"`
+	Stores        int     `json:"stores"`
+	Invalidations int     `json:"invalidations"` // Entries dropped because a document changed
+	Expirations   int     `json:"expirations"`
+	Evictions     int     `json:"evictions"`
+}
+
+// answerCache keeps LLM answers for repeated questions in memory
+type answerCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedAnswer // Normalized question + fingerprint -> answer
+	stats   AnswerCacheStats
+}
+
+var chatAnswerCache = &answerCache{entries: make(map[string]*cachedAnswer)}
+
+// Words that change the phrasing of a question but not what is asked
+var questionFillerWords = map[string]bool{
+	"what": true, "whats": true, "how": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "can": true, "may": true, "must": true, "need": true,
+	"please": true, "tell": true, "explain": true, "about": true, "me": true, "my": true,
+	"our": true, "we": true, "you": true, "your": true, "it": true, "this": true,
+	"that": true, "there": true, "any": true, "know": true,
+}
+
+// Normalized form of a question: its distinct stemmed terms in sorted order without
+// filler words, so "What is the VPN policy?" and "vpn policies" share a key
+func normalizeQuestion(question string) (string, map[string]bool) {
+	terms := make(map[string]bool)
+	for term := range termSet(question) {
+		if questionFillerWords[term] {
+			continue
+		}
+		if len(term) > 3 && strings.HasSuffix(term, "ies") {
+			term = strings.TrimSuffix(term, "ies") + "y"
+		} else if len(term) > 3 && strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss") {
+			term = strings.TrimSuffix(term, "s")
+		}
+		terms[term] = true
+	}
+
+	sorted := make([]string, 0, len(terms))
+	for term := range terms {
+		sorted = append(sorted, term)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, " "), terms
+}
+
+// Key of a chat turn in the answer cache
+type answerCacheKey struct {
+	Question    string
+	Documents   string // Fingerprint of the retrieved documents, prompt template and role
+	DocumentIDs []uint
+}
+
+// Fingerprint the documents behind a set of passages at their current version,
+// together with the prompt template and role that shape the answer
+func documentFingerprint(passages []RetrievedPassage, template *PromptTemplateRef, role string) (string, []uint) {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, passage := range passages {
+		if !seen[passage.DocumentID] {
+			seen[passage.DocumentID] = true
+			ids = append(ids, passage.DocumentID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	updated := make(map[uint]time.Time)
+	if db != nil && len(ids) > 0 {
+		var documents []PolicyFile
+		db.Select("id, updated_at").Find(&documents, ids)
+		for _, document := range documents {
+			updated[document.ID] = document.UpdatedAt
+		}
+	}
+
+	var parts []string
+	for _, id := range ids {
+		parts = append(parts, fmt.Sprintf("%d@%d", id, updated[id].UnixNano()))
+	}
+	if template != nil {
+		parts = append(parts, fmt.Sprintf("%s:v%d", template.Name, template.Version))
+	}
+	parts = append(parts, "role:"+role)
+	return strings.Join(parts, ","), ids
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for term := range a {
+		if b[term] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Get a cached answer for a question over the same documents. Exact normalized
+// matches are tried first, then the most similar paraphrase above the threshold.
+func (ac *answerCache) Get(cacheKey answerCacheKey, config AnswerCacheConfig) (*LLMResponse, bool) {
+	if !config.Enabled {
+		return nil, false
+	}
+	key, terms := normalizeQuestion(cacheKey.Question)
+	if key == "" {
+		return nil, false
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.expire(config.TTL)
+
+	entry, semantic := ac.entries[key+"|"+cacheKey.Documents], false
+	if entry == nil {
+		bestScore := 0.0
+		for _, candidate := range ac.entries {
+			if candidate.Documents != cacheKey.Documents {
+				continue
+			}
+			if score := jaccard(terms, candidate.Terms); score >= config.Similarity && score > bestScore {
+				entry, bestScore, semantic = candidate, score, true
+			}
+		}
+	}
+
+	if entry == nil {
+		ac.stats.Misses++
+		return nil, false
+	}
+
+	entry.Hits++
+	ac.stats.Hits++
+	if semantic {
+		ac.stats.SemanticHits++
+	}
+	response := entry.Response
+	return &response, true
+}
+
+// Store an answer, evicting the oldest entries beyond the size limit
+func (ac *answerCache) Put(cacheKey answerCacheKey, response LLMResponse, config AnswerCacheConfig) {
+	if !config.Enabled || config.MaxEntries <= 0 {
+		return
+	}
+	key, terms := normalizeQuestion(cacheKey.Question)
+	if key == "" {
+		return
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.entries[key+"|"+cacheKey.Documents] = &cachedAnswer{
+		Question:    cacheKey.Question,
+		Terms:       terms,
+		Documents:   cacheKey.Documents,
+		DocumentIDs: cacheKey.DocumentIDs,
+		Response:    response,
+		CreatedAt:   time.Now(),
+	}
+	ac.stats.Stores++
+
+	for len(ac.entries) > config.MaxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range ac.entries {
+			if oldestKey == "" || entry.CreatedAt.Before(oldest) {
+				oldestKey, oldest = key, entry.CreatedAt
+			}
+		}
+		delete(ac.entries, oldestKey)
+		ac.stats.Evictions++
+	}
+}
+
+// Drop every answer that was grounded in a document
+func (ac *answerCache) InvalidateDocument(documentID uint) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	dropped := 0
+	for key, entry := range ac.entries {
+		for _, id := range entry.DocumentIDs {
+			if id == documentID {
+				delete(ac.entries, key)
+				dropped++
+				break
+			}
+		}
+	}
+	ac.stats.Invalidations += dropped
+
+	if dropped > 0 {
+		log.Printf("🗑️  Invalidated %d cached answers for document %d", dropped, documentID)
+	}
+}
+
+// Remove all entries, keeping the counters
+func (ac *answerCache) Clear() int {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	cleared := len(ac.entries)
+	ac.entries = make(map[string]*cachedAnswer)
+	return cleared
+}
+
+func (ac *answerCache) Stats() AnswerCacheStats {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	stats := ac.stats
+	stats.Entries = len(ac.entries)
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// Caller must hold the lock
+func (ac *answerCache) expire(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	for key, entry := range ac.entries {
+		if time.Since(entry.CreatedAt) > ttl {
+			delete(ac.entries, key)
+			ac.stats.Expirations++
+		}
+	}
+}
+
+// Cache key for a chat turn. Returns false when the answer must not be shared:
+// follow-ups depend on the conversation, and questions carrying personal data
+// or flagged content must not be replayed to other users.
+func chatCacheKey(user User, message string, history []ChatMessage, grounded groundedChat) (answerCacheKey, bool) {
+	if len(history) > 0 || len(grounded.Passages) == 0 || len(grounded.Findings) > 0 {
+		return answerCacheKey{}, false
+	}
+	redactor := newRedactor()
+	redactor.Redact(message)
+	if redactor.Summary() != "" {
+		return answerCacheKey{}, false
+	}
+
+	documents, ids := documentFingerprint(grounded.Passages, grounded.Template, userPromptVariables(user, message).Role)
+	return answerCacheKey{Question: message, Documents: documents, DocumentIDs: ids}, true
+}
+
+// Look up a cached answer for a chat turn
+func cachedChatAnswer(key answerCacheKey) (*LLMResponse, bool) {
+	return chatAnswerCache.Get(key, loadAnswerCacheConfig())
+}
+
+// Cache a generated answer. Fallback mock answers are not kept so a recovered
+// provider is used again, and answers addressing the user by name stay private.
+func storeChatAnswer(key answerCacheKey, user User, response *LLMResponse) {
+	if response == nil || response.Text == "" || response.Provider == ProviderMock {
+		return
+	}
+	answerTerms := termSet(response.Text)
+	for name := range termSet(userPromptVariables(user, "").UserName) {
+		if answerTerms[name] {
+			return
+		}
+	}
+	chatAnswerCache.Put(key, *response, loadAnswerCacheConfig())
+}
+
+// Answer cache handlers (Admin only)
+
+func handleGetAnswerCacheStats(c *gin.Context) {
+	config := loadAnswerCacheConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":     config.Enabled,
+		"ttl_seconds": int(config.TTL.Seconds()),
+		"max_entries": config.MaxEntries,
+		"similarity":  config.Similarity,
+		"stats":       chatAnswerCache.Stats(),
+	})
+}
+
+func handleClearAnswerCache(c *gin.Context) {
+	cleared := chatAnswerCache.Clear()
+
+	userID, _ := c.Get("user_id")
+	logSystemActivity(c, userID.(uint), ActionDelete, fmt.Sprintf("Cleared chat answer cache (%d entries)", cleared))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Answer cache cleared", "cleared": cleared})
+}
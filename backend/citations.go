@@ -0,0 +1,218 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Citation links a claim in a chat answer to the policy passage backing it
+type Citation struct {
+	Marker       int    `json:"marker"` // Passage number as shown to the LLM, e.g. [1]
+	DocumentID   uint   `json:"document_id"`
+	DocumentName string `json:"document_name"`
+	ChunkIndex   int    `json:"chunk_index"`
+	Start        int    `json:"start"` // Byte offsets of the snippet in PolicyFile.Content
+	End          int    `json:"end"`
+	Snippet      string `json:"snippet"`
+	Claim        string `json:"claim,omitempty"`    // Answer sentence the citation supports
+	Inferred     bool   `json:"inferred,omitempty"` // True when the LLM gave no marker and the match was inferred
+}
+
+// Matches "[1]", "[1, 2]" as well as "[document 3]" / "[doc 3]" references
+var (
+	passageMarkerPattern  = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+	documentMarkerPattern = regexp.MustCompile(`(?i)\[(?:document|doc)\s*#?(\d+)\]`)
+	leadingMarkersPattern = regexp.MustCompile(`(?i)^(?:\[(?:(?:document|doc)\s*#?)?\d+(?:\s*,\s*\d+)*\]\s*)+`)
+	spaceBeforePunct      = regexp.MustCompile(`\s+([.,;:!?])`)
+)
+
+// Minimum share of claim terms a passage sentence must contain for an inferred citation
+const inferredCitationThreshold = 0.5
+
+// Build citations for an answer from the passages that were given to the LLM
+func buildCitations(answer string, passages []RetrievedPassage) []Citation {
+	if len(passages) == 0 || strings.TrimSpace(answer) == "" {
+		return nil
+	}
+
+	var citations []Citation
+	seen := make(map[string]bool)
+	add := func(citation Citation) {
+		key := strconv.FormatUint(uint64(citation.DocumentID), 10) + ":" + strconv.Itoa(citation.Start)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		citations = append(citations, citation)
+	}
+
+	claims := answerClaims(answer)
+
+	explicit := false
+	for _, claim := range claims {
+		for _, marker := range passageMarkerPattern.FindAllStringSubmatch(claim, -1) {
+			for _, number := range strings.Split(marker[1], ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(number))
+				if err != nil {
+					continue
+				}
+				explicit = true
+				if n < 1 || n > len(passages) {
+					log.Printf("Dropping citation [%d]: only %d passages were provided", n, len(passages))
+					continue
+				}
+				add(citeSentence(passages[n-1], n, claim, false))
+			}
+		}
+
+		for _, marker := range documentMarkerPattern.FindAllStringSubmatch(claim, -1) {
+			docID, err := strconv.ParseUint(marker[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			explicit = true
+			n, ok := bestPassageForDocument(passages, uint(docID), claim)
+			if !ok {
+				log.Printf("Dropping citation to document %d: it was not given to the model", docID)
+				continue
+			}
+			add(citeSentence(passages[n-1], n, claim, false))
+		}
+	}
+
+	if explicit {
+		return citations
+	}
+
+	// The model ignored the citation instructions, so attribute claims by term overlap
+	for _, claim := range claims {
+		claimTerms := termSet(claim)
+		if len(claimTerms) == 0 {
+			continue
+		}
+
+		bestPassage, bestScore := -1, 0.0
+		for i, passage := range passages {
+			_, _, score := bestSentence(passage.Text, claimTerms)
+			if score > bestScore {
+				bestPassage, bestScore = i, score
+			}
+		}
+
+		if bestPassage >= 0 && bestScore >= inferredCitationThreshold {
+			add(citeSentence(passages[bestPassage], bestPassage+1, claim, true))
+		}
+	}
+
+	return citations
+}
+
+// Split an answer into claim sentences. Markers placed after the full stop,
+// as in "... every 90 days. [1]", are moved back to the sentence they follow.
+func answerClaims(answer string) []string {
+	var claims []string
+	for _, span := range sentenceSpans(answer) {
+		sentence := answer[span[0]:span[1]]
+		if leading := leadingMarkersPattern.FindString(sentence); leading != "" && len(claims) > 0 {
+			claims[len(claims)-1] += " " + strings.TrimSpace(leading)
+			sentence = strings.TrimSpace(sentence[len(leading):])
+		}
+		if strings.TrimSpace(stripCitationMarkers(sentence)) == "" {
+			continue
+		}
+		claims = append(claims, sentence)
+	}
+	return claims
+}
+
+// Pick the passage of a document that best supports a claim, returning its 1-based marker
+func bestPassageForDocument(passages []RetrievedPassage, docID uint, claim string) (int, bool) {
+	claimTerms := termSet(claim)
+	best, bestScore := 0, -1.0
+	for i, passage := range passages {
+		if passage.DocumentID != docID {
+			continue
+		}
+		_, _, score := bestSentence(passage.Text, claimTerms)
+		if score > bestScore {
+			best, bestScore = i+1, score
+		}
+	}
+	return best, best > 0
+}
+
+// Create a citation quoting the passage sentence that best matches the claim
+func citeSentence(passage RetrievedPassage, marker int, claim string, inferred bool) Citation {
+	start, end, _ := bestSentence(passage.Text, termSet(stripCitationMarkers(claim)))
+	return Citation{
+		Marker:       marker,
+		DocumentID:   passage.DocumentID,
+		DocumentName: passage.DocumentName,
+		ChunkIndex:   passage.Index,
+		Start:        passage.Start + start,
+		End:          passage.Start + end,
+		Snippet:      passage.Text[start:end],
+		Claim:        strings.TrimSpace(stripCitationMarkers(claim)),
+		Inferred:     inferred,
+	}
+}
+
+// Find the sentence of a passage sharing the most terms with the claim.
+// Returns its offsets within the passage and the share of claim terms it covers.
+func bestSentence(text string, claimTerms map[string]bool) (int, int, float64) {
+	spans := sentenceSpans(text)
+	if len(spans) == 0 {
+		return 0, len(text), 0
+	}
+
+	bestStart, bestEnd, bestScore := spans[0][0], spans[0][1], 0.0
+	for _, span := range spans {
+		sentenceTerms := termSet(text[span[0]:span[1]])
+		hits := 0
+		for term := range claimTerms {
+			if sentenceTerms[term] {
+				hits++
+			}
+		}
+
+		score := 0.0
+		if len(claimTerms) > 0 {
+			score = float64(hits) / float64(len(claimTerms))
+		}
+		if score > bestScore {
+			bestStart, bestEnd, bestScore = span[0], span[1], score
+		}
+	}
+
+	return bestStart, bestEnd, bestScore
+}
+
+func stripCitationMarkers(text string) string {
+	text = passageMarkerPattern.ReplaceAllString(text, "")
+	text = documentMarkerPattern.ReplaceAllString(text, "")
+	return spaceBeforePunct.ReplaceAllString(text, "$1")
+}
+
+// Drop citations that reference documents or offsets outside the sources given to the model
+func validateCitations(citations []Citation, sources []ChatSource) []Citation {
+	var valid []Citation
+	for _, citation := range citations {
+		ok := false
+		for _, source := range sources {
+			if source.DocumentID == citation.DocumentID &&
+				citation.Start >= source.Start && citation.End <= source.End && citation.Start < citation.End {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			log.Printf("Dropping citation to document %d (%d-%d): not among the provided sources", citation.DocumentID, citation.Start, citation.End)
+			continue
+		}
+		valid = append(valid, citation)
+	}
+	return valid
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Conversation model grouping a user's chat messages
+type Conversation struct {
+	ID        uint          `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint          `json:"user_id" gorm:"not null;index"`
+	User      User          `json:"-" gorm:"foreignKey:UserID"`
+	Title     string        `json:"title" gorm:"not null;size:255"`
+	Messages  []ChatMessage `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
+	CreatedAt time.Time     `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time     `json:"updated_at" gorm:"autoUpdateTime;index"`
+}
+
+// ChatMessage model for a single turn in a conversation
+type ChatMessage struct {
+	ID                    uint         `json:"id" gorm:"primaryKey;autoIncrement"`
+	ConversationID        uint         `json:"conversation_id" gorm:"not null;index"`
+	Role                  string       `json:"role" gorm:"not null;size:20"` // "user" or "assistant"
+	Content               string       `json:"content" gorm:"type:text;not null"`
+	Type                  string       `json:"type,omitempty" gorm:"size:50"`         // Chat type the message was produced for
+	Intent                string       `json:"intent,omitempty" gorm:"size:30;index"` // Classified intent of the exchange
+	Provider              string       `json:"provider,omitempty" gorm:"size:50"`     // LLM provider for assistant messages
+	Model                 string       `json:"model,omitempty" gorm:"size:100"`
+	PromptTemplateID      *uint        `json:"prompt_template_id,omitempty" gorm:"index"`
+	PromptTemplateVersion int          `json:"prompt_template_version,omitempty"`
+	SourcesJSON           string       `json:"-" gorm:"column:sources;type:text"`      // Store as JSON string in DB
+	Sources               []ChatSource `json:"sources,omitempty" gorm:"-"`             // For JSON response
+	CitationsJSON         string       `json:"-" gorm:"column:citations;type:text"`    // Store as JSON string in DB
+	Citations             []Citation   `json:"citations,omitempty" gorm:"-"`           // For JSON response
+	DocumentIDsJSON       string       `json:"-" gorm:"column:document_ids;type:text"` // Store as JSON string in DB
+	DocumentIDs           []uint       `json:"document_ids,omitempty" gorm:"-"`        // Documents the answer drew on or returned, best first
+	CreatedAt             time.Time    `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// Chat message roles
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Request structure for creating a conversation
+type CreateConversationRequest struct {
+	Title string `json:"title"`
+}
+
+// Helper methods for ChatMessage
+func (m *ChatMessage) BeforeSave(tx *gorm.DB) error {
+	// Convert Sources, Citations and DocumentIDs to JSON strings for database storage
+	if len(m.Sources) > 0 {
+		sourcesJSON, err := json.Marshal(m.Sources)
+		if err != nil {
+			return err
+		}
+		m.SourcesJSON = string(sourcesJSON)
+	}
+	if len(m.Citations) > 0 {
+		citationsJSON, err := json.Marshal(m.Citations)
+		if err != nil {
+			return err
+		}
+		m.CitationsJSON = string(citationsJSON)
+	}
+	if len(m.DocumentIDs) > 0 {
+		documentIDsJSON, err := json.Marshal(m.DocumentIDs)
+		if err != nil {
+			return err
+		}
+		m.DocumentIDsJSON = string(documentIDsJSON)
+	}
+	return nil
+}
+
+func (m *ChatMessage) AfterFind(tx *gorm.DB) error {
+	// Convert JSON strings back to Sources, Citations and DocumentIDs
+	if m.SourcesJSON != "" {
+		if err := json.Unmarshal([]byte(m.SourcesJSON), &m.Sources); err != nil {
+			m.Sources = nil
+		}
+	}
+	if m.CitationsJSON != "" {
+		if err := json.Unmarshal([]byte(m.CitationsJSON), &m.Citations); err != nil {
+			m.Citations = nil
+		}
+	}
+	if m.DocumentIDsJSON != "" {
+		if err := json.Unmarshal([]byte(m.DocumentIDsJSON), &m.DocumentIDs); err != nil {
+			m.DocumentIDs = nil
+		}
+	}
+	return nil
+}
+
+// Derive a conversation title from its first message
+func conversationTitle(message string) string {
+	title := strings.Join(strings.Fields(message), " ")
+	if title == "" {
+		return "New conversation"
+	}
+	if len([]rune(title)) > 60 {
+		title = string([]rune(title)[:60]) + "..."
+	}
+	return title
+}
+
+// Find a conversation owned by the given user
+func findUserConversation(userID uint, conversationID string) (*Conversation, error) {
+	var conversation Conversation
+	if err := db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// Resolve the conversation a chat request belongs to, creating one when none is given,
+// and load the bounded window of prior turns to send to the LLM
+func loadChatConversation(userID uint, req ChatRequest) (*Conversation, []ChatMessage, error) {
+	if req.ConversationID == nil {
+		conversation := Conversation{
+			UserID: userID,
+			Title:  conversationTitle(req.Message),
+		}
+		if err := db.Create(&conversation).Error; err != nil {
+			return nil, nil, err
+		}
+		return &conversation, nil, nil
+	}
+
+	conversation, err := findUserConversation(userID, strconv.FormatUint(uint64(*req.ConversationID), 10))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maxMessages := getEnvInt("CHAT_HISTORY_MESSAGES", 6)
+	var recent []ChatMessage
+	if maxMessages > 0 {
+		if err := db.Where("conversation_id = ?", conversation.ID).
+			Order("created_at DESC, id DESC").Limit(maxMessages).Find(&recent).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Restore chronological order
+	for i, j := 0, len(recent)-1; i < j; i, j = i+1, j-1 {
+		recent[i], recent[j] = recent[j], recent[i]
+	}
+
+	return conversation, historyWindow(recent, getEnvInt("CHAT_HISTORY_TOKENS", 800)), nil
+}
+
+// Keep the most recent messages that fit in the token budget
+func historyWindow(messages []ChatMessage, maxTokens int) []ChatMessage {
+	usedTokens := 0
+	start := len(messages)
+	for start > 0 {
+		tokens := estimateTokens(messages[start-1].Content)
+		if usedTokens+tokens > maxTokens {
+			break
+		}
+		usedTokens += tokens
+		start--
+	}
+	return messages[start:]
+}
+
+// Search query for a chat turn. Follow-up questions such as "and on my phone?"
+// carry little on their own, so the previous user turn is included.
+func retrievalQuery(message string, history []ChatMessage) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == MessageRoleUser {
+			return history[i].Content + " " + message
+		}
+	}
+	return message
+}
+
+// Documents an answer is based on: its source passages for grounded answers,
+// then the documents it returned, e.g. for document lookups
+func answerDocumentIDs(response ChatResponse) []uint {
+	var ids []uint
+	seen := make(map[uint]bool)
+	add := func(id uint) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, source := range response.Sources {
+		add(source.DocumentID)
+	}
+	for _, document := range response.PolicyFiles {
+		add(document.ID)
+	}
+	return ids
+}
+
+// Persist a user message and the assistant response, returning the stored assistant message
+func saveChatExchange(conversation *Conversation, req ChatRequest, response ChatResponse) (*ChatMessage, error) {
+	userMessage := ChatMessage{
+		ConversationID: conversation.ID,
+		Role:           MessageRoleUser,
+		Content:        req.Message,
+		Type:           req.Type,
+		Intent:         response.Intent,
+	}
+	assistantMessage := ChatMessage{
+		ConversationID: conversation.ID,
+		Role:           MessageRoleAssistant,
+		Content:        response.Response,
+		Type:           response.Type,
+		Intent:         response.Intent,
+		Provider:       response.Provider,
+		Model:          response.Model,
+		Sources:        response.Sources,
+		Citations:      response.Citations,
+		DocumentIDs:    answerDocumentIDs(response),
+	}
+
+	if response.PromptTemplate != nil {
+		if response.PromptTemplate.ID != 0 {
+			templateID := response.PromptTemplate.ID
+			assistantMessage.PromptTemplateID = &templateID
+		}
+		assistantMessage.PromptTemplateVersion = response.PromptTemplate.Version
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&userMessage).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&assistantMessage).Error; err != nil {
+			return err
+		}
+		// Bump the conversation so it sorts first in the list
+		return tx.Model(conversation).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &assistantMessage, nil
+}
+
+// Conversation handlers
+
+// Create an empty conversation
+func handleCreateConversation(c *gin.Context) {
+	var req CreateConversationRequest
+	// The body is optional; without a title the default one is used
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	conversation := Conversation{
+		UserID: userID.(uint),
+		Title:  conversationTitle(req.Title),
+	}
+
+	if err := db.Create(&conversation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+		return
+	}
+
+	logAuditActivity(c, userID.(uint), ActionCreate, ResourceConversation, &conversation.ID, conversation.Title, "Created conversation")
+
+	c.JSON(http.StatusCreated, conversation)
+}
+
+// List the current user's conversations, most recently active first
+func handleGetConversations(c *gin.Context) {
+	page := 1
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	query := db.Model(&Conversation{}).Where("user_id = ?", userID)
+
+	var total int64
+	query.Count(&total)
+
+	var conversations []Conversation
+	if err := query.Order("updated_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Get a conversation with all of its messages
+func handleGetConversation(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var conversation Conversation
+	err := db.Preload("Messages", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("created_at ASC, id ASC")
+	}).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&conversation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// Delete a conversation and its messages
+func handleDeleteConversation(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	conversation, err := findUserConversation(userID.(uint), c.Param("id"))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation"})
+		}
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&ChatFeedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&ChatMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(conversation).Error
+	})
+	if err != nil {
+		log.Printf("Failed to delete conversation %d: %v", conversation.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation"})
+		return
+	}
+
+	logAuditActivity(c, userID.(uint), ActionDelete, ResourceConversation, &conversation.ID, conversation.Title, fmt.Sprintf("Deleted conversation %d", conversation.ID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted successfully"})
+}
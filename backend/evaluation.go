@@ -0,0 +1,589 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Offline evaluation of chat answer quality. A golden set of questions with the
+// facts and documents a good answer contains is run through the chat pipeline
+// (guardrails, intent routing, then the grounded LLM and answer cache), and the scores are written as JSON and Markdown reports so that model
+// and prompt changes can be compared run against run:
+//
+//	security-chatbot-backend eval -llm mock -baseline eval-reports/previous.json
+
+// EvalSet is a golden set of evaluation cases
+type EvalSet struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Cases       []EvalCase `json:"cases"`
+}
+
+// EvalCase is one question with what a correct answer must contain
+type EvalCase struct {
+	ID                string   `json:"id"`
+	Question          string   `json:"question"`
+	Role              string   `json:"role,omitempty"`            // Role of the asking user, defaults to user
+	ExpectedIntent    string   `json:"expected_intent,omitempty"` // Checked when set
+	ExpectedDocuments []string `json:"expected_documents"`        // Document names that should be retrieved and cited
+	ExpectedFacts     []string `json:"expected_facts"`            // Phrases the answer should state
+}
+
+// EvalMetrics are the scores of a case, or their means over a run. Metrics that
+// do not apply to a case (no expected documents, no expected intent) are nil.
+type EvalMetrics struct {
+	RetrievalRecall   *float64 `json:"retrieval_recall"`   // Expected documents among the passages given to the LLM
+	CitationPrecision *float64 `json:"citation_precision"` // Citations that point at expected documents
+	FactCoverage      *float64 `json:"fact_coverage"`      // Expected facts stated in the answer
+	IntentAccuracy    *float64 `json:"intent_accuracy"`
+	Score             float64  `json:"score"` // Mean of retrieval recall, citation precision and fact coverage
+}
+
+// EvalCaseResult is the outcome of one case
+type EvalCaseResult struct {
+	ID                 string      `json:"id"`
+	Question           string      `json:"question"`
+	Intent             string      `json:"intent"`
+	Route              string      `json:"route"` // How the pipeline answered, see the EvalRoute constants
+	Provider           string      `json:"provider"`
+	Model              string      `json:"model"`
+	Answer             string      `json:"answer"`
+	RetrievedDocuments []string    `json:"retrieved_documents"`
+	CitedDocuments     []string    `json:"cited_documents"`
+	InvalidCitations   int         `json:"invalid_citations"` // Citations dropped for pointing outside the passages
+	MissingDocuments   []string    `json:"missing_documents,omitempty"`
+	MissingFacts       []string    `json:"missing_facts,omitempty"`
+	Metrics            EvalMetrics `json:"metrics"`
+	LatencyMs          int64       `json:"latency_ms"`
+}
+
+// How the chat pipeline answered a case
+const (
+	EvalRouteGrounded = "grounded" // LLM answer from the policy passages
+	EvalRouteCached   = "cached"   // Grounded answer replayed from the answer cache
+	EvalRouteIntent   = "intent"   // Answered by the intent's handler without the LLM
+	EvalRouteBlocked  = "blocked"  // Rejected by the input guardrails
+)
+
+// EvalReport is the result of a run
+type EvalReport struct {
+	Label          string             `json:"label"`
+	Set            string             `json:"set"`
+	StartedAt      time.Time          `json:"started_at"`
+	DurationMs     int64              `json:"duration_ms"`
+	LLM            string             `json:"llm"` // Provider chain the run used
+	PromptTemplate *PromptTemplateRef `json:"prompt_template"`
+	Documents      int                `json:"documents"` // Active documents searched
+	Summary        EvalMetrics        `json:"summary"`
+	FallbackCases  int                `json:"fallback_cases"` // Cases answered by the mock after the selected LLM failed
+	Cases          []EvalCaseResult   `json:"cases"`
+}
+
+// Run the eval command and return the process exit code
+func runEvalCommand(args []string) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	casesPath := flags.String("cases", "eval/golden.json", "golden set of evaluation cases")
+	llm := flags.String("llm", "configured", `LLM to evaluate: "configured" for the LLM_PROVIDERS chain, or a provider name such as mock or ollama`)
+	outDir := flags.String("out", "eval-reports", "directory for the JSON and Markdown reports")
+	label := flags.String("label", "", "name of the run, defaults to the LLM and a timestamp")
+	baselinePath := flags.String("baseline", "", "earlier JSON report to compare against")
+	failUnder := flags.Float64("fail-under", 0, "exit with status 1 when the overall score is below this value (0-1)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: security-chatbot-backend eval [flags]")
+		fmt.Fprintln(flags.Output(), "Runs a golden set of questions through the chat pipeline against the configured database.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	set, err := loadEvalSet(*casesPath)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+
+	var baseline *EvalReport
+	if *baselinePath != "" {
+		if baseline, err = loadEvalReport(*baselinePath); err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+	}
+
+	db, err = connectDB()
+	if err != nil {
+		log.Printf("❌ Failed to connect to database: %v", err)
+		return 1
+	}
+	if err := initializeDatabase(); err != nil {
+		log.Printf("❌ Failed to initialize database: %v", err)
+		return 1
+	}
+
+	providers, err := evalProviders(*llm)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+	llmProviders = providers
+
+	if *label == "" {
+		*label = fmt.Sprintf("%s-%s", *llm, time.Now().Format("20060102-150405"))
+	}
+
+	report := runEvaluation(context.Background(), set, *label, *llm)
+
+	if err := writeEvalReports(report, baseline, *outDir); err != nil {
+		log.Printf("❌ Failed to write reports: %v", err)
+		return 1
+	}
+
+	log.Printf("📊 %s: score %.2f, retrieval recall %s, citation precision %s, fact coverage %s over %d cases",
+		report.Label, report.Summary.Score, formatMetric(report.Summary.RetrievalRecall),
+		formatMetric(report.Summary.CitationPrecision), formatMetric(report.Summary.FactCoverage), len(report.Cases))
+
+	if report.Summary.Score < *failUnder {
+		log.Printf("❌ Score %.2f is below the required %.2f", report.Summary.Score, *failUnder)
+		return 1
+	}
+	return 0
+}
+
+func loadEvalSet(path string) (EvalSet, error) {
+	var set EvalSet
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return set, fmt.Errorf("failed to read evaluation cases: %v", err)
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return set, fmt.Errorf("invalid evaluation cases in %s: %v", path, err)
+	}
+	if len(set.Cases) == 0 {
+		return set, fmt.Errorf("no evaluation cases in %s", path)
+	}
+	for i, evalCase := range set.Cases {
+		if strings.TrimSpace(evalCase.Question) == "" {
+			return set, fmt.Errorf("case %d in %s has no question", i+1, path)
+		}
+		if evalCase.ID == "" {
+			set.Cases[i].ID = fmt.Sprintf("case-%d", i+1)
+		}
+	}
+	if set.Name == "" {
+		set.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return set, nil
+}
+
+func loadEvalReport(path string) (*EvalReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline report: %v", err)
+	}
+	var report EvalReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid baseline report %s: %v", path, err)
+	}
+	return &report, nil
+}
+
+// Provider chain for a run: the configured one, or a single named provider with
+// the same resilience and redaction wrappers the server would use
+func evalProviders(name string) ([]LLMProvider, error) {
+	if name == "configured" {
+		return initLLMProviders(), nil
+	}
+
+	provider, err := newLLMProvider(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot evaluate provider %q: %v", name, err)
+	}
+	if name != ProviderMock {
+		if shouldRedact(provider) {
+			provider = newRedactingProvider(provider)
+		}
+		provider = newResilientProvider(provider, loadProviderPolicy(name))
+	}
+	return []LLMProvider{provider}, nil
+}
+
+// Run every case through intent classification, retrieval, the LLM and citation building
+func runEvaluation(ctx context.Context, set EvalSet, label, llm string) EvalReport {
+	started := time.Now()
+	report := EvalReport{
+		Label:     label,
+		Set:       set.Name,
+		StartedAt: started,
+		LLM:       llm,
+	}
+
+	var documents int64
+	db.Model(&PolicyFile{}).Where("is_active = ?", true).Count(&documents)
+	report.Documents = int(documents)
+
+	for _, evalCase := range set.Cases {
+		result, template := evaluateCase(ctx, evalCase)
+		if report.PromptTemplate == nil {
+			report.PromptTemplate = template
+		}
+		if result.Provider == ProviderMock && llm != ProviderMock {
+			report.FallbackCases++
+		}
+		report.Cases = append(report.Cases, result)
+		log.Printf("   %-32s score %.2f (%s, %dms)", result.ID, result.Metrics.Score, result.Provider, result.LatencyMs)
+	}
+
+	report.Summary = summarizeEvalMetrics(report.Cases)
+	report.DurationMs = time.Since(started).Milliseconds()
+	return report
+}
+
+func evaluateCase(ctx context.Context, evalCase EvalCase) (EvalCaseResult, *PromptTemplateRef) {
+	role := evalCase.Role
+	if role == "" {
+		role = RoleUser
+	}
+	user := User{Username: "evaluation", FirstName: "Evaluation", LastName: "User", Role: role}
+
+	started := time.Now()
+	result := EvalCaseResult{
+		ID:                 evalCase.ID,
+		Question:           evalCase.Question,
+		RetrievedDocuments: []string{},
+		CitedDocuments:     []string{},
+	}
+
+	// The same route a chat message takes: guardrails, then the intent's handler,
+	// with the grounded LLM for messages it leaves to the policies
+	var intent ChatIntent
+	var response ChatResponse
+	var grounded groundedChat
+	message, _, blocked := guardChatInput(evalCase.Question, loadGuardrailPolicy().Input)
+	if blocked {
+		result.Route = EvalRouteBlocked
+	} else {
+		// Handlers expect a request context; an evaluation has no HTTP request
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", nil).WithContext(ctx)
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+
+		intent = classifyChatTurn(ctx, user.ID, ChatRequest{Message: message}, nil)
+		var answered bool
+		response, answered = intentResponse(c, user, 0, intent.Intent, message, nil)
+		switch {
+		case answered:
+			result.Route = EvalRouteIntent
+		default:
+			response, grounded = answerFromPolicies(ctx, user, message, nil)
+			result.Route = EvalRouteGrounded
+			if response.Cached {
+				result.Route = EvalRouteCached
+			}
+		}
+	}
+	citations := response.Citations
+	valid := validateCitations(citations, response.Sources)
+
+	result.Intent = intent.Intent
+	result.Provider = response.Provider
+	result.Model = response.Model
+	result.Answer = response.Response
+	result.InvalidCitations = len(citations) - len(valid)
+	result.LatencyMs = time.Since(started).Milliseconds()
+
+	// Documents the answer drew on, or returned when it was not grounded
+	retrieved := make(map[string]bool)
+	addRetrieved := func(documentName string) {
+		name := strings.ToLower(documentName)
+		if !retrieved[name] {
+			retrieved[name] = true
+			result.RetrievedDocuments = append(result.RetrievedDocuments, documentName)
+		}
+	}
+	for _, passage := range grounded.Passages {
+		addRetrieved(passage.DocumentName)
+	}
+	if len(grounded.Passages) == 0 {
+		for _, document := range response.PolicyFiles {
+			addRetrieved(document.Name)
+		}
+	}
+	cited := make(map[string]bool)
+	for _, citation := range valid {
+		name := strings.ToLower(citation.DocumentName)
+		if !cited[name] {
+			cited[name] = true
+			result.CitedDocuments = append(result.CitedDocuments, citation.DocumentName)
+		}
+	}
+
+	if len(evalCase.ExpectedDocuments) > 0 {
+		expected := make(map[string]bool)
+		found := 0
+		for _, name := range evalCase.ExpectedDocuments {
+			expected[strings.ToLower(name)] = true
+			if retrieved[strings.ToLower(name)] {
+				found++
+			} else {
+				result.MissingDocuments = append(result.MissingDocuments, name)
+			}
+		}
+		recall := float64(found) / float64(len(evalCase.ExpectedDocuments))
+		result.Metrics.RetrievalRecall = &recall
+
+		// An answer that cites nothing cannot be checked against the policies
+		precision := 0.0
+		if len(citations) > 0 {
+			correct := 0
+			for _, citation := range valid {
+				if expected[strings.ToLower(citation.DocumentName)] {
+					correct++
+				}
+			}
+			precision = float64(correct) / float64(len(citations))
+		}
+		result.Metrics.CitationPrecision = &precision
+	}
+
+	if len(evalCase.ExpectedFacts) > 0 {
+		answer := stripCitationMarkers(response.Response)
+		covered := 0
+		for _, fact := range evalCase.ExpectedFacts {
+			if answerStatesFact(answer, fact) {
+				covered++
+			} else {
+				result.MissingFacts = append(result.MissingFacts, fact)
+			}
+		}
+		coverage := float64(covered) / float64(len(evalCase.ExpectedFacts))
+		result.Metrics.FactCoverage = &coverage
+	}
+
+	if evalCase.ExpectedIntent != "" {
+		accuracy := 0.0
+		if intent.Intent == evalCase.ExpectedIntent {
+			accuracy = 1
+		}
+		result.Metrics.IntentAccuracy = &accuracy
+	}
+
+	result.Metrics.Score = combinedEvalScore(result.Metrics)
+	return result, grounded.Template
+}
+
+// A fact is stated when the answer contains it verbatim or contains all of its terms
+func answerStatesFact(answer, fact string) bool {
+	if strings.Contains(strings.ToLower(answer), strings.ToLower(fact)) {
+		return true
+	}
+	factTerms := termSet(fact)
+	if len(factTerms) == 0 {
+		return false
+	}
+	answerTerms := termSet(answer)
+	for term := range factTerms {
+		if !answerTerms[term] {
+			return false
+		}
+	}
+	return true
+}
+
+func combinedEvalScore(metrics EvalMetrics) float64 {
+	total, count := 0.0, 0
+	for _, metric := range []*float64{metrics.RetrievalRecall, metrics.CitationPrecision, metrics.FactCoverage} {
+		if metric != nil {
+			total += *metric
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// Mean of each metric over the cases it applies to
+func summarizeEvalMetrics(cases []EvalCaseResult) EvalMetrics {
+	mean := func(value func(EvalMetrics) *float64) *float64 {
+		total, count := 0.0, 0
+		for _, result := range cases {
+			if v := value(result.Metrics); v != nil {
+				total += *v
+				count++
+			}
+		}
+		if count == 0 {
+			return nil
+		}
+		average := total / float64(count)
+		return &average
+	}
+
+	summary := EvalMetrics{
+		RetrievalRecall:   mean(func(m EvalMetrics) *float64 { return m.RetrievalRecall }),
+		CitationPrecision: mean(func(m EvalMetrics) *float64 { return m.CitationPrecision }),
+		FactCoverage:      mean(func(m EvalMetrics) *float64 { return m.FactCoverage }),
+		IntentAccuracy:    mean(func(m EvalMetrics) *float64 { return m.IntentAccuracy }),
+	}
+	summary.Score = combinedEvalScore(summary)
+	return summary
+}
+
+// Write <label>.json and <label>.md into the output directory
+func writeEvalReports(report EvalReport, baseline *EvalReport, outDir string) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, report.Label)
+
+	jsonPath := filepath.Join(outDir, name+".json")
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return err
+	}
+	markdownPath := filepath.Join(outDir, name+".md")
+	if err := os.WriteFile(markdownPath, []byte(renderEvalMarkdown(report, baseline)), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("📝 Reports written to %s and %s", jsonPath, markdownPath)
+	return nil
+}
+
+func formatMetric(value *float64) string {
+	if value == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.2f", *value)
+}
+
+// Change from the baseline, e.g. "+0.12"
+func formatDelta(current, previous *float64) string {
+	if current == nil || previous == nil {
+		return ""
+	}
+	delta := *current - *previous
+	if math.Abs(delta) < 0.005 {
+		return "±0.00"
+	}
+	return fmt.Sprintf("%+.2f", delta)
+}
+
+func renderEvalMarkdown(report EvalReport, baseline *EvalReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Chat evaluation: %s\n\n", report.Label)
+	fmt.Fprintf(&b, "- **Set:** %s (%d cases)\n", report.Set, len(report.Cases))
+	fmt.Fprintf(&b, "- **Started:** %s (%.1fs)\n", report.StartedAt.UTC().Format(transcriptTimeFormat), float64(report.DurationMs)/1000)
+	fmt.Fprintf(&b, "- **LLM:** %s\n", report.LLM)
+	if report.PromptTemplate != nil {
+		fmt.Fprintf(&b, "- **Prompt template:** %s v%d\n", report.PromptTemplate.Name, report.PromptTemplate.Version)
+	}
+	fmt.Fprintf(&b, "- **Documents:** %d active\n", report.Documents)
+	if report.FallbackCases > 0 {
+		fmt.Fprintf(&b, "- **Fallbacks:** %d cases were answered by the mock provider because the LLM failed\n", report.FallbackCases)
+	}
+
+	b.WriteString("\n## Summary\n\n")
+	score := func(m EvalMetrics) *float64 { return &m.Score }
+	metrics := []struct {
+		name  string
+		value func(EvalMetrics) *float64
+	}{
+		{"Score", score},
+		{"Retrieval recall", func(m EvalMetrics) *float64 { return m.RetrievalRecall }},
+		{"Citation precision", func(m EvalMetrics) *float64 { return m.CitationPrecision }},
+		{"Fact coverage", func(m EvalMetrics) *float64 { return m.FactCoverage }},
+		{"Intent accuracy", func(m EvalMetrics) *float64 { return m.IntentAccuracy }},
+	}
+	if baseline != nil {
+		fmt.Fprintf(&b, "| Metric | %s | %s (baseline) | Change |\n|---|---|---|---|\n", report.Label, baseline.Label)
+		for _, metric := range metrics {
+			current, previous := metric.value(report.Summary), metric.value(baseline.Summary)
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", metric.name, formatMetric(current), formatMetric(previous), formatDelta(current, previous))
+		}
+	} else {
+		b.WriteString("| Metric | Value |\n|---|---|\n")
+		for _, metric := range metrics {
+			fmt.Fprintf(&b, "| %s | %s |\n", metric.name, formatMetric(metric.value(report.Summary)))
+		}
+	}
+
+	previous := make(map[string]EvalCaseResult)
+	if baseline != nil {
+		for _, result := range baseline.Cases {
+			previous[result.ID] = result
+		}
+	}
+
+	b.WriteString("\n## Cases\n\n")
+	if baseline != nil {
+		b.WriteString("| Case | Score | Change | Recall | Citations | Facts | Intent | Route | Provider |\n|---|---|---|---|---|---|---|---|---|\n")
+	} else {
+		b.WriteString("| Case | Score | Recall | Citations | Facts | Intent | Route | Provider |\n|---|---|---|---|---|---|---|---|\n")
+	}
+	for _, result := range report.Cases {
+		fmt.Fprintf(&b, "| %s | %.2f ", result.ID, result.Metrics.Score)
+		if baseline != nil {
+			change := "new"
+			if earlier, exists := previous[result.ID]; exists {
+				current, prior := result.Metrics.Score, earlier.Metrics.Score
+				change = formatDelta(&current, &prior)
+			}
+			fmt.Fprintf(&b, "| %s ", change)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+			formatMetric(result.Metrics.RetrievalRecall), formatMetric(result.Metrics.CitationPrecision),
+			formatMetric(result.Metrics.FactCoverage), result.Intent, result.Route, result.Provider)
+	}
+
+	var failing []EvalCaseResult
+	for _, result := range report.Cases {
+		if len(result.MissingDocuments) > 0 || len(result.MissingFacts) > 0 || result.InvalidCitations > 0 {
+			failing = append(failing, result)
+		}
+	}
+	sort.SliceStable(failing, func(i, j int) bool { return failing[i].Metrics.Score < failing[j].Metrics.Score })
+
+	if len(failing) > 0 {
+		b.WriteString("\n## Gaps\n")
+		for _, result := range failing {
+			fmt.Fprintf(&b, "\n### %s\n\n> %s\n\n", result.ID, result.Question)
+			if len(result.MissingDocuments) > 0 {
+				fmt.Fprintf(&b, "- Not retrieved: %s\n", strings.Join(result.MissingDocuments, ", "))
+			}
+			if len(result.MissingFacts) > 0 {
+				fmt.Fprintf(&b, "- Facts missing from the answer: %s\n", strings.Join(result.MissingFacts, "; "))
+			}
+			if result.InvalidCitations > 0 {
+				fmt.Fprintf(&b, "- %d citations pointed outside the retrieved passages\n", result.InvalidCitations)
+			}
+			fmt.Fprintf(&b, "- Answer: %s\n", strings.Join(strings.Fields(result.Answer), " "))
+		}
+	}
+	return b.String()
+}
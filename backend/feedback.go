@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ChatFeedback model for a user's rating of an assistant answer.
+// Provider, model and topic are copied from the message so reports stay stable.
+type ChatFeedback struct {
+	ID             uint        `json:"id" gorm:"primaryKey;autoIncrement"`
+	MessageID      uint        `json:"message_id" gorm:"not null;uniqueIndex:idx_feedback_message_user"`
+	Message        ChatMessage `json:"-" gorm:"foreignKey:MessageID"`
+	ConversationID uint        `json:"conversation_id" gorm:"not null;index"`
+	UserID         uint        `json:"user_id" gorm:"not null;uniqueIndex:idx_feedback_message_user"`
+	Rating         string      `json:"rating" gorm:"not null;size:10;index"` // "up" or "down"
+	Reason         string      `json:"reason,omitempty" gorm:"size:50;index"`
+	Comment        string      `json:"comment,omitempty" gorm:"type:text"`
+	Question       string      `json:"question,omitempty" gorm:"type:text"` // User message the answer replied to
+	Topic          string      `json:"topic" gorm:"size:100;index"`
+	Provider       string      `json:"provider,omitempty" gorm:"size:50;index"`
+	Model          string      `json:"model,omitempty" gorm:"size:100"`
+	CreatedAt      time.Time   `json:"created_at" gorm:"autoCreateTime;index"`
+	UpdatedAt      time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Feedback ratings
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Reasons a user can give for a rating
+var feedbackReasons = map[string]bool{
+	"helpful":      true,
+	"inaccurate":   true,
+	"incomplete":   true,
+	"irrelevant":   true,
+	"outdated":     true,
+	"unclear":      true,
+	"bad_citation": true,
+	"other":        true,
+}
+
+// Request structure for rating a chat answer
+type ChatFeedbackRequest struct {
+	Rating  string `json:"rating" binding:"required"`
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+// FeedbackStat aggregates ratings for one topic, document or provider
+type FeedbackStat struct {
+	Key          string         `json:"key"`
+	Label        string         `json:"label"`
+	Up           int            `json:"up"`
+	Down         int            `json:"down"`
+	Total        int            `json:"total"`
+	Satisfaction float64        `json:"satisfaction"` // Share of thumbs up, 0-1
+	Reasons      map[string]int `json:"reasons,omitempty"`
+}
+
+// Documents a stored answer matched. Messages saved before document IDs were
+// recorded fall back to their source passages.
+func messageDocumentIDs(message ChatMessage) []uint {
+	if len(message.DocumentIDs) > 0 {
+		return message.DocumentIDs
+	}
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, source := range message.Sources {
+		if !seen[source.DocumentID] {
+			seen[source.DocumentID] = true
+			ids = append(ids, source.DocumentID)
+		}
+	}
+	return ids
+}
+
+// Topic of a rated answer: the category of its best matched document,
+// or the chat type when the answer did not match any document
+func feedbackTopic(message ChatMessage) string {
+	if ids := messageDocumentIDs(message); len(ids) > 0 {
+		var document PolicyFile
+		if err := db.Select("category").First(&document, ids[0]).Error; err == nil && document.Category != "" {
+			return document.Category
+		}
+	}
+	if message.Type != "" {
+		return message.Type
+	}
+	return "general"
+}
+
+// User message an assistant message answered
+func precedingQuestion(message ChatMessage) string {
+	var question ChatMessage
+	err := db.Where("conversation_id = ? AND role = ? AND id < ?", message.ConversationID, MessageRoleUser, message.ID).
+		Order("id DESC").First(&question).Error
+	if err != nil {
+		return ""
+	}
+	return question.Content
+}
+
+// Feedback handlers
+
+// Rate an assistant message in one of the current user's conversations.
+// Rating the same message again replaces the earlier feedback.
+func handleSubmitFeedback(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req ChatFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Rating = strings.ToLower(strings.TrimSpace(req.Rating))
+	if req.Rating != RatingUp && req.Rating != RatingDown {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rating must be 'up' or 'down'"})
+		return
+	}
+	req.Reason = strings.ToLower(strings.TrimSpace(req.Reason))
+	if req.Reason != "" && !feedbackReasons[req.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown reason %q", req.Reason)})
+		return
+	}
+	if len(req.Comment) > 2000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment must be at most 2000 characters"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uint)
+
+	// Only answers in the user's own conversations can be rated
+	var message ChatMessage
+	err = db.Joins("JOIN conversations ON conversations.id = chat_messages.conversation_id").
+		Where("chat_messages.id = ? AND conversations.user_id = ?", messageID, uid).
+		First(&message).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message"})
+		}
+		return
+	}
+	if message.Role != MessageRoleAssistant {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only assistant answers can be rated"})
+		return
+	}
+
+	var feedback ChatFeedback
+	err = db.Where("message_id = ? AND user_id = ?", message.ID, uid).First(&feedback).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feedback"})
+		return
+	}
+	created := err == gorm.ErrRecordNotFound
+
+	feedback.MessageID = message.ID
+	feedback.ConversationID = message.ConversationID
+	feedback.UserID = uid
+	feedback.Rating = req.Rating
+	feedback.Reason = req.Reason
+	feedback.Comment = strings.TrimSpace(req.Comment)
+	feedback.Question = precedingQuestion(message)
+	feedback.Topic = feedbackTopic(message)
+	feedback.Provider = message.Provider
+	feedback.Model = message.Model
+
+	if err := db.Save(&feedback).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+
+	action := ActionUpdate
+	status := http.StatusOK
+	if created {
+		action = ActionCreate
+		status = http.StatusCreated
+	}
+	logAuditActivity(c, uid, action, ResourceFeedback, &feedback.ID, fmt.Sprintf("message %d", message.ID),
+		fmt.Sprintf("Rated answer %d in conversation %d: %s %s", message.ID, message.ConversationID, feedback.Rating, feedback.Reason))
+
+	c.JSON(status, feedback)
+}
+
+// Apply the shared report filters (from, to, rating, provider) to a feedback query
+func filterFeedback(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if from := c.Query("from"); from != "" {
+		if fromTime, err := time.Parse("2006-01-02", from); err == nil {
+			query = query.Where("chat_feedbacks.created_at >= ?", fromTime)
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if toTime, err := time.Parse("2006-01-02", to); err == nil {
+			query = query.Where("chat_feedbacks.created_at <= ?", toTime.Add(24*time.Hour))
+		}
+	}
+	if rating := c.Query("rating"); rating != "" {
+		query = query.Where("chat_feedbacks.rating = ?", rating)
+	}
+	if provider := c.Query("provider"); provider != "" {
+		query = query.Where("chat_feedbacks.provider = ?", provider)
+	}
+	return query
+}
+
+// List individual feedback entries (Admin only)
+func handleGetFeedback(c *gin.Context) {
+	page := 1
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 200 {
+			limit = l
+		}
+	}
+
+	query := filterFeedback(c, db.Model(&ChatFeedback{}))
+	if topic := c.Query("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var feedback []ChatFeedback
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&feedback).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feedback"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"feedback": feedback,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Aggregate feedback by query topic, matched document and LLM provider (Admin only).
+// Groups are ordered worst first so the documents most in need of rewriting lead.
+func handleGetFeedbackReport(c *gin.Context) {
+	var feedback []ChatFeedback
+	if err := filterFeedback(c, db.Model(&ChatFeedback{})).Preload("Message").Find(&feedback).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feedback"})
+		return
+	}
+
+	byTopic := make(map[string]*FeedbackStat)
+	byDocument := make(map[string]*FeedbackStat)
+	byProvider := make(map[string]*FeedbackStat)
+	totals := &FeedbackStat{Key: "all", Label: "All answers"}
+
+	// Names of the matched documents, including ones that have since been deactivated
+	var documentIDs []uint
+	for _, entry := range feedback {
+		documentIDs = append(documentIDs, messageDocumentIDs(entry.Message)...)
+	}
+	names := make(map[uint]string)
+	if len(documentIDs) > 0 {
+		var documents []PolicyFile
+		if err := db.Select("id", "name").Where("id IN ?", documentIDs).Find(&documents).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		for _, document := range documents {
+			names[document.ID] = document.Name
+		}
+	}
+
+	for _, entry := range feedback {
+		totals.add(entry)
+		statFor(byTopic, entry.Topic, entry.Topic).add(entry)
+
+		provider := entry.Provider
+		if provider == "" {
+			provider = "none" // Answers that did not use an LLM, e.g. policy search
+		}
+		statFor(byProvider, provider, provider).add(entry)
+
+		// Count each document once per answer, however many passages it contributed
+		for _, documentID := range messageDocumentIDs(entry.Message) {
+			key := strconv.FormatUint(uint64(documentID), 10)
+			name, exists := names[documentID]
+			if !exists {
+				name = "Document " + key // Removed since
+			}
+			statFor(byDocument, key, name).add(entry)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totals":      totals,
+		"by_topic":    sortedFeedbackStats(byTopic),
+		"by_document": sortedFeedbackStats(byDocument),
+		"by_provider": sortedFeedbackStats(byProvider),
+	})
+}
+
+func statFor(stats map[string]*FeedbackStat, key, label string) *FeedbackStat {
+	stat, exists := stats[key]
+	if !exists {
+		stat = &FeedbackStat{Key: key, Label: label}
+		stats[key] = stat
+	}
+	return stat
+}
+
+func (s *FeedbackStat) add(entry ChatFeedback) {
+	s.Total++
+	if entry.Rating == RatingUp {
+		s.Up++
+	} else {
+		s.Down++
+	}
+	s.Satisfaction = float64(s.Up) / float64(s.Total)
+
+	if entry.Reason != "" {
+		if s.Reasons == nil {
+			s.Reasons = make(map[string]int)
+		}
+		s.Reasons[entry.Reason]++
+	}
+}
+
+// Lowest satisfaction first, then most ratings
+func sortedFeedbackStats(stats map[string]*FeedbackStat) []FeedbackStat {
+	result := make([]FeedbackStat, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Satisfaction != result[j].Satisfaction {
+			return result[i].Satisfaction < result[j].Satisfaction
+		}
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
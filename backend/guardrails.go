@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Guardrail actions, configured separately for user input and retrieved content
+const (
+	GuardrailBlock    = "block"    // Reject the message / drop the passage
+	GuardrailSanitize = "sanitize" // Remove the matched text and continue
+	GuardrailFlag     = "flag"     // Continue unchanged but record the finding
+	GuardrailOff      = "off"
+)
+
+// Where a finding was detected
+const (
+	GuardrailSourceInput    = "input"
+	GuardrailSourceDocument = "document"
+)
+
+// GuardrailPolicy holds the action taken for each source of prompt text
+type GuardrailPolicy struct {
+	Input   string // Chat messages from the user
+	Context string // PolicyFile chunks placed in the prompt
+}
+
+// GuardrailFinding is a prompt-injection pattern found in prompt text
+type GuardrailFinding struct {
+	Rule         string `json:"rule"`
+	Match        string `json:"match"`
+	Source       string `json:"source"`
+	DocumentID   uint   `json:"document_id,omitempty"`
+	DocumentName string `json:"document_name,omitempty"`
+	Action       string `json:"action"`
+}
+
+// Rule matching one family of injection or jailbreak attempts
+type injectionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+var injectionRules = []injectionRule{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override)\b[^.\n]{0,40}?\b(?:previous|prior|above|earlier|all|any|your|the|these)\b[^.\n]{0,20}?\b(?:instructions?|prompts?|rules|directions|guidelines)\b`)},
+	{"role_override", regexp.MustCompile(`(?i)\byou are now\b|\bfrom now on,? you (?:are|will)\b|\bpretend (?:to be|you are)\b|\bact as (?:an? )?(?:unrestricted|unfiltered|uncensored|jailbroken|evil)\b`)},
+	{"jailbreak_persona", regexp.MustCompile(`(?i)\bdo anything now\b|\bdeveloper mode\b|\bjailbr(?:ea|o)k\w*\b|\bgod mode\b`)},
+	// DAN is also a name and an acronym, so only the persona prompt counts
+	{"jailbreak_persona", regexp.MustCompile(`\bDAN (?i:mode|prompt)\b|\b(?i:you are|you're|act as|pretend to be|become|enable|activate|enter) DAN\b`)},
+	{"prompt_exfiltration", regexp.MustCompile(`(?i)\b(?:reveal|show|print|repeat|output|display|leak)\b[^.\n]{0,30}?\b(?:system prompt|initial prompt|hidden (?:prompt|instructions)|your (?:instructions|prompt))\b`)},
+	{"delimiter_injection", regexp.MustCompile(`(?im)<\|?(?:im_start|im_end|system|endoftext)\|?>|\[/?INST\]|<</?SYS>>|^\s*(?:system|assistant)\s*:`)},
+	{"safety_bypass", regexp.MustCompile(`(?i)\b(?:disable|turn off|bypass|ignore)\b[^.\n]{0,20}?\b(?:safety|guardrails?|filters?|content polic(?:y|ies)|restrictions)\b`)},
+}
+
+// Text that replaces sanitized matches
+const guardrailPlaceholder = "[removed]"
+
+// Load guardrail actions. GUARDRAIL_INPUT_ACTION defaults to block and
+// GUARDRAIL_CONTEXT_ACTION to sanitize, so one poisoned document cannot
+// take down every answer that retrieves it.
+func loadGuardrailPolicy() GuardrailPolicy {
+	action := func(key, defaultValue string) string {
+		value := strings.ToLower(getEnv(key, defaultValue))
+		switch value {
+		case GuardrailBlock, GuardrailSanitize, GuardrailFlag, GuardrailOff:
+			return value
+		}
+		log.Printf("Invalid guardrail action for %s: %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return GuardrailPolicy{
+		Input:   action("GUARDRAIL_INPUT_ACTION", GuardrailBlock),
+		Context: action("GUARDRAIL_CONTEXT_ACTION", GuardrailSanitize),
+	}
+}
+
+// Find injection patterns in a text
+func scanForInjection(text string) []GuardrailFinding {
+	var findings []GuardrailFinding
+	for _, rule := range injectionRules {
+		for _, match := range rule.Pattern.FindAllString(text, -1) {
+			findings = append(findings, GuardrailFinding{Rule: rule.Name, Match: strings.TrimSpace(match)})
+		}
+	}
+	return findings
+}
+
+// Replace every injection pattern in a text with a placeholder
+func sanitizeInjection(text string) string {
+	for _, rule := range injectionRules {
+		text = rule.Pattern.ReplaceAllString(text, guardrailPlaceholder)
+	}
+	return text
+}
+
+// Apply the input policy to a chat message. Returns the message to use,
+// the findings and whether the message must be rejected.
+func guardChatInput(message string, action string) (string, []GuardrailFinding, bool) {
+	if action == GuardrailOff {
+		return message, nil, false
+	}
+
+	findings := scanForInjection(message)
+	if len(findings) == 0 {
+		return message, nil, false
+	}
+	for i := range findings {
+		findings[i].Source = GuardrailSourceInput
+		findings[i].Action = action
+	}
+
+	switch action {
+	case GuardrailBlock:
+		return message, findings, true
+	case GuardrailSanitize:
+		sanitized := sanitizeInjection(message)
+		remaining := strings.ReplaceAll(sanitized, guardrailPlaceholder, "")
+		if strings.IndexFunc(remaining, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			// Nothing but the injection was sent
+			for i := range findings {
+				findings[i].Action = GuardrailBlock
+			}
+			return message, findings, true
+		}
+		return sanitized, findings, false
+	default:
+		return message, findings, false
+	}
+}
+
+// Apply the context policy to retrieved passages. Returns the passages to cite,
+// the matching passages to place in the prompt (sanitized when configured) and the findings.
+// Citation offsets keep pointing at the original document text.
+func guardPassages(passages []RetrievedPassage, action string) ([]RetrievedPassage, []RetrievedPassage, []GuardrailFinding) {
+	if action == GuardrailOff {
+		return passages, passages, nil
+	}
+
+	var kept, prompt []RetrievedPassage
+	var findings []GuardrailFinding
+	for _, passage := range passages {
+		passageFindings := scanForInjection(passage.Text)
+		for i := range passageFindings {
+			passageFindings[i].Source = GuardrailSourceDocument
+			passageFindings[i].DocumentID = passage.DocumentID
+			passageFindings[i].DocumentName = passage.DocumentName
+			passageFindings[i].Action = action
+		}
+		findings = append(findings, passageFindings...)
+
+		if len(passageFindings) > 0 {
+			switch action {
+			case GuardrailBlock:
+				continue
+			case GuardrailSanitize:
+				sanitized := passage
+				sanitized.Text = sanitizeInjection(passage.Text)
+				kept = append(kept, passage)
+				prompt = append(prompt, sanitized)
+				continue
+			}
+		}
+
+		kept = append(kept, passage)
+		prompt = append(prompt, passage)
+	}
+	return kept, prompt, findings
+}
+
+// Write an audit entry for each finding so IT security can review the attempt
+func logGuardrailFindings(c *gin.Context, findings []GuardrailFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	for _, finding := range findings {
+		action := ActionFlag
+		switch finding.Action {
+		case GuardrailBlock:
+			action = ActionBlock
+		case GuardrailSanitize:
+			action = ActionSanitize
+		}
+
+		var resourceID *uint
+		resourceName := "chat input"
+		if finding.Source == GuardrailSourceDocument {
+			documentID := finding.DocumentID
+			resourceID = &documentID
+			resourceName = finding.DocumentName
+		}
+
+		log.Printf("🛡️  Guardrail %s: %s in %s (%q)", finding.Action, finding.Rule, finding.Source, finding.Match)
+		logAuditActivity(c, userID.(uint), action, ResourceGuardrail, resourceID, resourceName,
+			fmt.Sprintf("Prompt injection rule %s matched in %s: %q", finding.Rule, finding.Source, finding.Match))
+	}
+}
+
+// Apply the input guardrail to a chat request, sanitizing its message in place.
+// Writes the error response and returns false when the message is blocked.
+func guardChatRequest(c *gin.Context, req *ChatRequest) bool {
+	message, findings, blocked := guardChatInput(req.Message, loadGuardrailPolicy().Input)
+	logGuardrailFindings(c, findings)
+	if blocked {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Your message was blocked by the security guardrails. Please rephrase your question.",
+			"code":  "prompt_injection_detected",
+		})
+		return false
+	}
+	req.Message = message
+	return true
+}
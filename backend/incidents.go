@@ -0,0 +1,656 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Incident model for a security incident reported by a user, following the
+// Incident Response Policy: report within the reporting window, then escalate
+// L1 (Help Desk) -> L2 (Security Team) -> L3 (CISO).
+type Incident struct {
+	ID                 uint              `json:"id" gorm:"primaryKey;autoIncrement"`
+	Reference          string            `json:"reference" gorm:"-"` // INC-000042, derived from the ID
+	ReporterID         uint              `json:"reporter_id" gorm:"not null;index"`
+	Reporter           User              `json:"-" gorm:"foreignKey:ReporterID"`
+	Type               string            `json:"type" gorm:"not null;size:50;index"`
+	Description        string            `json:"description" gorm:"type:text;not null"`
+	AffectedAssetsJSON string            `json:"-" gorm:"column:affected_assets;type:text"` // Store as JSON string in DB
+	AffectedAssets     []string          `json:"affected_assets" gorm:"-"`                  // For JSON response
+	ObservedAt         time.Time         `json:"observed_at" gorm:"not null"`
+	Severity           string            `json:"severity" gorm:"not null;size:20;index"`
+	EscalationLevel    int               `json:"escalation_level" gorm:"not null;default:1"`
+	AssigneeRole       string            `json:"assignee_role" gorm:"size:50"`
+	AssigneeID         *uint             `json:"assignee_id,omitempty" gorm:"index"`
+	Status             string            `json:"status" gorm:"not null;size:20;index"`
+	Source             string            `json:"source" gorm:"size:20"` // "chat" or "api"
+	ConversationID     *uint             `json:"conversation_id,omitempty" gorm:"index"`
+	ReportDueAt        time.Time         `json:"report_due_at"` // Observed time plus the reporting window
+	ReportedLate       bool              `json:"reported_late"`
+	AcknowledgeDueAt   time.Time         `json:"acknowledge_due_at"`
+	ResolveDueAt       time.Time         `json:"resolve_due_at"`
+	AcknowledgedAt     *time.Time        `json:"acknowledged_at,omitempty"`
+	ResolvedAt         *time.Time        `json:"resolved_at,omitempty"`
+	ClosedAt           *time.Time        `json:"closed_at,omitempty"`
+	AcknowledgeOverdue bool              `json:"acknowledge_overdue" gorm:"-"`
+	ResolutionOverdue  bool              `json:"resolution_overdue" gorm:"-"`
+	Overdue            bool              `json:"overdue" gorm:"-"`
+	History            []IncidentHistory `json:"history,omitempty" gorm:"foreignKey:IncidentID"`
+	CreatedAt          time.Time         `json:"created_at" gorm:"autoCreateTime;index"`
+	UpdatedAt          time.Time         `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// IncidentHistory model for one change to an incident
+type IncidentHistory struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	IncidentID uint      `json:"incident_id" gorm:"not null;index"`
+	ActorID    uint      `json:"actor_id" gorm:"not null"`
+	Actor      string    `json:"actor" gorm:"size:100"`
+	Action     string    `json:"action" gorm:"not null;size:20"` // reported, status, severity, escalated, assigned, details
+	FromValue  string    `json:"from_value,omitempty" gorm:"size:50"`
+	ToValue    string    `json:"to_value,omitempty" gorm:"size:50"`
+	Note       string    `json:"note,omitempty" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Incident types
+const (
+	IncidentPhishing           = "phishing"
+	IncidentMalware            = "malware"
+	IncidentLostDevice         = "lost_device"
+	IncidentAccountCompromise  = "account_compromise"
+	IncidentDataLeak           = "data_leak"
+	IncidentUnauthorizedAccess = "unauthorized_access"
+	IncidentOther              = "other"
+)
+
+// Incident severities
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Incident statuses
+const (
+	IncidentStatusOpen          = "open"
+	IncidentStatusAcknowledged  = "acknowledged"
+	IncidentStatusInvestigating = "investigating"
+	IncidentStatusResolved      = "resolved"
+	IncidentStatusClosed        = "closed"
+)
+
+// Incident history actions
+const (
+	IncidentActionReported  = "reported"
+	IncidentActionStatus    = "status"
+	IncidentActionSeverity  = "severity"
+	IncidentActionEscalated = "escalated"
+	IncidentActionAssigned  = "assigned"
+	IncidentActionDetails   = "details"
+)
+
+// Incident sources
+const (
+	IncidentSourceChat = "chat"
+	IncidentSourceAPI  = "api"
+)
+
+// Escalation matrix from the Incident Response Policy
+var escalationLevels = map[int]string{
+	1: "L1 (Help Desk)",
+	2: "L2 (Security Team)",
+	3: "L3 (CISO)",
+}
+
+const maxEscalationLevel = 3
+
+// Default severity per incident type
+var incidentTypeSeverity = map[string]string{
+	IncidentPhishing:           SeverityMedium,
+	IncidentMalware:            SeverityHigh,
+	IncidentLostDevice:         SeverityHigh,
+	IncidentAccountCompromise:  SeverityHigh,
+	IncidentDataLeak:           SeverityCritical,
+	IncidentUnauthorizedAccess: SeverityHigh,
+	IncidentOther:              SeverityMedium,
+}
+
+// IncidentSLA is the time allowed to acknowledge and resolve an incident
+type IncidentSLA struct {
+	Acknowledge time.Duration
+	Resolve     time.Duration
+	Level       int // Escalation level the incident starts at
+}
+
+var incidentSLAs = map[string]IncidentSLA{
+	SeverityLow:      {Acknowledge: 24 * time.Hour, Resolve: 7 * 24 * time.Hour, Level: 1},
+	SeverityMedium:   {Acknowledge: 4 * time.Hour, Resolve: 72 * time.Hour, Level: 1},
+	SeverityHigh:     {Acknowledge: time.Hour, Resolve: 24 * time.Hour, Level: 2},
+	SeverityCritical: {Acknowledge: 15 * time.Minute, Resolve: 4 * time.Hour, Level: 3},
+}
+
+// Allowed status changes; resolved incidents can be reopened until closed
+var incidentTransitions = map[string][]string{
+	IncidentStatusOpen:          {IncidentStatusAcknowledged, IncidentStatusInvestigating, IncidentStatusResolved},
+	IncidentStatusAcknowledged:  {IncidentStatusInvestigating, IncidentStatusResolved},
+	IncidentStatusInvestigating: {IncidentStatusResolved},
+	IncidentStatusResolved:      {IncidentStatusInvestigating, IncidentStatusClosed},
+	IncidentStatusClosed:        {},
+}
+
+// Time allowed between observing an incident and reporting it
+func incidentReportWindow() time.Duration {
+	return getEnvDuration("INCIDENT_REPORT_WINDOW", 2*time.Hour)
+}
+
+// Request structures for incidents
+type CreateIncidentRequest struct {
+	Type           string     `json:"type" binding:"required"`
+	Description    string     `json:"description" binding:"required"`
+	AffectedAssets []string   `json:"affected_assets"`
+	ObservedAt     *time.Time `json:"observed_at"` // Defaults to now
+	Severity       string     `json:"severity"`    // Defaults by type
+}
+
+type UpdateIncidentRequest struct {
+	Status     *string `json:"status"`
+	Severity   *string `json:"severity"`
+	AssigneeID *uint   `json:"assignee_id"`
+	Note       string  `json:"note"`
+}
+
+type EscalateIncidentRequest struct {
+	Note string `json:"note" binding:"required"` // Why the incident needs the next level
+}
+
+// Helper methods for Incident
+func (i *Incident) BeforeSave(tx *gorm.DB) error {
+	assetsJSON, err := json.Marshal(i.AffectedAssets)
+	if err != nil {
+		return err
+	}
+	i.AffectedAssetsJSON = string(assetsJSON)
+	return nil
+}
+
+func (i *Incident) AfterFind(tx *gorm.DB) error {
+	if i.AffectedAssetsJSON != "" {
+		if err := json.Unmarshal([]byte(i.AffectedAssetsJSON), &i.AffectedAssets); err != nil {
+			i.AffectedAssets = []string{}
+		}
+	}
+	i.refreshSLA(time.Now())
+	return nil
+}
+
+// Fill in the reference and overdue flags
+func (i *Incident) refreshSLA(now time.Time) {
+	i.Reference = fmt.Sprintf("INC-%06d", i.ID)
+	finished := i.Status == IncidentStatusResolved || i.Status == IncidentStatusClosed
+	i.AcknowledgeOverdue = i.AcknowledgedAt == nil && !finished && now.After(i.AcknowledgeDueAt)
+	i.ResolutionOverdue = !finished && now.After(i.ResolveDueAt)
+	i.Overdue = i.AcknowledgeOverdue || i.ResolutionOverdue
+}
+
+// Set the SLA deadlines for the current severity, counted from when the incident was reported
+func (i *Incident) applySLA() {
+	sla := incidentSLAs[i.Severity]
+	i.AcknowledgeDueAt = i.CreatedAt.Add(sla.Acknowledge)
+	i.ResolveDueAt = i.CreatedAt.Add(sla.Resolve)
+}
+
+// Users who work incidents and see every report
+func canManageIncidents(c *gin.Context) bool {
+	role, _ := c.Get("user_role")
+	return role == RoleAdmin || role == RoleITSecurity
+}
+
+func validIncidentType(incidentType string) bool {
+	_, exists := incidentTypeSeverity[incidentType]
+	return exists
+}
+
+func validSeverity(severity string) bool {
+	_, exists := incidentSLAs[severity]
+	return exists
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range incidentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Build a new incident with its severity, escalation level and SLA timers
+func newIncident(reporter User, incidentType, description string, assets []string, observedAt time.Time, severity string) Incident {
+	now := time.Now()
+	if severity == "" {
+		severity = incidentTypeSeverity[incidentType]
+	}
+	if observedAt.IsZero() || observedAt.After(now) {
+		observedAt = now
+	}
+	if assets == nil {
+		assets = []string{}
+	}
+
+	incident := Incident{
+		ReporterID:      reporter.ID,
+		Type:            incidentType,
+		Description:     strings.TrimSpace(description),
+		AffectedAssets:  assets,
+		ObservedAt:      observedAt,
+		Severity:        severity,
+		EscalationLevel: incidentSLAs[severity].Level,
+		AssigneeRole:    RoleITSecurity,
+		Status:          IncidentStatusOpen,
+		ReportDueAt:     observedAt.Add(incidentReportWindow()),
+		CreatedAt:       now,
+	}
+	incident.ReportedLate = now.After(incident.ReportDueAt)
+	incident.applySLA()
+	return incident
+}
+
+// Save a new incident together with its first history entry
+func createIncident(incident *Incident, reporter User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(incident).Error; err != nil {
+			return err
+		}
+		incident.History = []IncidentHistory{{
+			IncidentID: incident.ID,
+			ActorID:    reporter.ID,
+			Actor:      reporter.Username,
+			Action:     IncidentActionReported,
+			ToValue:    incident.Status,
+			Note:       fmt.Sprintf("Reported via %s, severity %s, escalation %s", incident.Source, incident.Severity, escalationLevels[incident.EscalationLevel]),
+		}}
+		if err := tx.Create(&incident.History).Error; err != nil {
+			return err
+		}
+		incident.refreshSLA(time.Now())
+		return nil
+	})
+}
+
+func auditIncident(c *gin.Context, userID uint, action string, incident Incident, details string) {
+	logAuditActivity(c, userID, action, ResourceIncident, &incident.ID, incident.Reference, details)
+}
+
+// Incident type guessed from a chat message
+var incidentTypePatterns = []struct {
+	incidentType string
+	pattern      *regexp.Regexp
+}{
+	{IncidentDataLeak, regexp.MustCompile(`(?i)\b(?:data (?:breach|leak)|leaked|sent (?:it |\w+ )?to the wrong|exposed (?:customer|personal|confidential))`)},
+	{IncidentLostDevice, regexp.MustCompile(`(?i)\b(?:lost|stolen|misplaced)\b.*\b(?:laptop|phone|device|badge|token|yubikey)`)},
+	{IncidentMalware, regexp.MustCompile(`(?i)\b(?:malware|virus|ransomware|trojan|infected|encrypted my files)`)},
+	{IncidentAccountCompromise, regexp.MustCompile(`(?i)\b(?:hacked|compromised|entered my password|someone (?:logged|signed) in|account takeover)`)},
+	{IncidentPhishing, regexp.MustCompile(`(?i)\b(?:phish|suspicious (?:email|link|attachment|call|message)|scam|clicked)`)},
+	{IncidentUnauthorizedAccess, regexp.MustCompile(`(?i)\b(?:unauthori[sz]ed|tailgat|someone accessed|intruder)`)},
+}
+
+func incidentTypeFromMessage(message string) string {
+	for _, candidate := range incidentTypePatterns {
+		if candidate.pattern.MatchString(message) {
+			return candidate.incidentType
+		}
+	}
+	return IncidentOther
+}
+
+var observedAgoPattern = regexp.MustCompile(`(?i)\b(\d+|an?)\s+(minute|min|hour|hr)s?\s+ago\b`)
+
+// When the incident happened, from phrases like "about 3 hours ago"; now otherwise
+func observedAtFromMessage(message string, now time.Time) time.Time {
+	match := observedAgoPattern.FindStringSubmatch(message)
+	if match == nil {
+		return now
+	}
+	amount, err := strconv.Atoi(match[1])
+	if err != nil {
+		amount = 1 // "a" or "an"
+	}
+	unit := time.Minute
+	if strings.HasPrefix(strings.ToLower(match[2]), "h") {
+		unit = time.Hour
+	}
+	return now.Add(-time.Duration(amount) * unit)
+}
+
+// Latest unresolved incident the user reported in a conversation
+func findOpenChatIncident(user User, conversationID uint) (*Incident, error) {
+	var incident Incident
+	err := db.Where("reporter_id = ? AND conversation_id = ? AND status NOT IN ?", user.ID, conversationID,
+		[]string{IncidentStatusResolved, IncidentStatusClosed}).Order("created_at DESC").First(&incident).Error
+	if err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+// File an incident from a chat message. Further reports in the same conversation
+// are added to the open incident rather than filing duplicates.
+func fileIncidentFromChat(c *gin.Context, user User, conversationID uint, message string) (*Incident, bool, error) {
+	existing, err := findOpenChatIncident(user, conversationID)
+	if err == nil {
+		existing.Description += "\n\n" + strings.TrimSpace(message)
+		entry := IncidentHistory{IncidentID: existing.ID, ActorID: user.ID, Actor: user.Username, Action: IncidentActionDetails, Note: "Added details via chat"}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(existing).Update("description", existing.Description).Error; err != nil {
+				return err
+			}
+			return tx.Create(&entry).Error
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		auditIncident(c, user.ID, ActionUpdate, *existing, "Added details to incident via chat")
+		return existing, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	incident := newIncident(user, incidentTypeFromMessage(message), message, nil, observedAtFromMessage(message, time.Now()), "")
+	incident.Source = IncidentSourceChat
+	incident.ConversationID = &conversationID
+	if err := createIncident(&incident, user); err != nil {
+		return nil, false, err
+	}
+	auditIncident(c, user.ID, ActionCreate, incident,
+		fmt.Sprintf("Reported %s incident via chat (severity %s, %s)", incident.Type, incident.Severity, escalationLevels[incident.EscalationLevel]))
+	return &incident, true, nil
+}
+
+// Incident handlers
+
+// Report an incident
+func handleCreateIncident(c *gin.Context) {
+	var req CreateIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validIncidentType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown incident type %q", req.Type)})
+		return
+	}
+	if req.Severity != "" && !validSeverity(req.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown severity %q", req.Severity)})
+		return
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Description is required"})
+		return
+	}
+
+	var observedAt time.Time
+	if req.ObservedAt != nil {
+		observedAt = *req.ObservedAt
+	}
+	assets := make([]string, 0, len(req.AffectedAssets))
+	for _, asset := range req.AffectedAssets {
+		if asset = strings.TrimSpace(asset); asset != "" {
+			assets = append(assets, asset)
+		}
+	}
+
+	user := currentUser(c)
+	incident := newIncident(user, req.Type, req.Description, assets, observedAt, req.Severity)
+	incident.Source = IncidentSourceAPI
+	if err := createIncident(&incident, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report incident"})
+		return
+	}
+
+	details := fmt.Sprintf("Reported %s incident (severity %s, %s)", incident.Type, incident.Severity, escalationLevels[incident.EscalationLevel])
+	if incident.ReportedLate {
+		details += fmt.Sprintf(" - reported %s after it was observed", time.Since(incident.ObservedAt).Round(time.Minute))
+	}
+	auditIncident(c, user.ID, ActionCreate, incident, details)
+
+	c.JSON(http.StatusCreated, incident)
+}
+
+// List incidents. Users see their own reports; the security team sees all and can
+// filter by status, severity, type and overdue=true.
+func handleGetIncidents(c *gin.Context) {
+	query := db.Model(&Incident{})
+	if !canManageIncidents(c) {
+		userID, _ := c.Get("user_id")
+		query = query.Where("reporter_id = ?", userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if incidentType := c.Query("type"); incidentType != "" {
+		query = query.Where("type = ?", incidentType)
+	}
+
+	var incidents []Incident
+	if err := query.Order("created_at DESC").Find(&incidents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incidents"})
+		return
+	}
+
+	overdueOnly := c.Query("overdue") == "true"
+	result := make([]Incident, 0, len(incidents))
+	overdue := 0
+	for _, incident := range incidents {
+		if incident.Overdue {
+			overdue++
+		} else if overdueOnly {
+			continue
+		}
+		result = append(result, incident)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"incidents": result,
+		"total":     len(result),
+		"overdue":   overdue,
+	})
+}
+
+// Find an incident the current user may see
+func findIncident(c *gin.Context) (Incident, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return Incident{}, false
+	}
+
+	query := db.Preload("History", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at ASC, id ASC") })
+	if !canManageIncidents(c) {
+		userID, _ := c.Get("user_id")
+		query = query.Where("reporter_id = ?", userID)
+	}
+
+	var incident Incident
+	if err := query.First(&incident, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		}
+		return Incident{}, false
+	}
+	return incident, true
+}
+
+// Get an incident with its status history
+func handleGetIncident(c *gin.Context) {
+	incident, ok := findIncident(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, incident)
+}
+
+// Change the status, severity or assignee of an incident (security team only)
+func handleUpdateIncident(c *gin.Context) {
+	incident, ok := findIncident(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := currentUser(c)
+	now := time.Now()
+	var changes []IncidentHistory
+	record := func(action, from, to string) {
+		changes = append(changes, IncidentHistory{
+			IncidentID: incident.ID, ActorID: user.ID, Actor: user.Username,
+			Action: action, FromValue: from, ToValue: to, Note: req.Note,
+		})
+	}
+
+	if req.Status != nil && *req.Status != incident.Status {
+		if !canTransition(incident.Status, *req.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot change status from %s to %s", incident.Status, *req.Status)})
+			return
+		}
+		record(IncidentActionStatus, incident.Status, *req.Status)
+		incident.Status = *req.Status
+
+		switch incident.Status {
+		case IncidentStatusAcknowledged, IncidentStatusInvestigating:
+			incident.ResolvedAt = nil
+		case IncidentStatusResolved:
+			incident.ResolvedAt = &now
+		case IncidentStatusClosed:
+			incident.ClosedAt = &now
+		}
+	}
+
+	if req.Severity != nil && *req.Severity != incident.Severity {
+		if !validSeverity(*req.Severity) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown severity %q", *req.Severity)})
+			return
+		}
+		record(IncidentActionSeverity, incident.Severity, *req.Severity)
+		incident.Severity = *req.Severity
+		incident.applySLA()
+
+		// A more severe incident starts higher in the escalation matrix
+		if level := incidentSLAs[incident.Severity].Level; level > incident.EscalationLevel {
+			record(IncidentActionEscalated, escalationLevels[incident.EscalationLevel], escalationLevels[level])
+			incident.EscalationLevel = level
+		}
+	}
+
+	if req.AssigneeID != nil && (incident.AssigneeID == nil || *incident.AssigneeID != *req.AssigneeID) {
+		var assignee User
+		if err := db.Where("id = ? AND is_active = ? AND role IN ?", *req.AssigneeID, true, []string{RoleITSecurity, RoleAdmin}).First(&assignee).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incidents can only be assigned to active IT security staff"})
+			return
+		}
+		from := ""
+		if incident.AssigneeID != nil {
+			var previous User
+			if db.Select("username").First(&previous, *incident.AssigneeID).Error == nil {
+				from = previous.Username
+			}
+		}
+		record(IncidentActionAssigned, from, assignee.Username)
+		incident.AssigneeID = &assignee.ID
+	}
+
+	if len(changes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No changes to apply"})
+		return
+	}
+	if incident.AcknowledgedAt == nil {
+		incident.AcknowledgedAt = &now // Any action by the security team acknowledges the report
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("History").Save(&incident).Error; err != nil {
+			return err
+		}
+		return tx.Create(&changes).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update incident"})
+		return
+	}
+	incident.History = append(incident.History, changes...)
+	incident.refreshSLA(now)
+
+	var summary []string
+	for _, change := range changes {
+		summary = append(summary, fmt.Sprintf("%s %s -> %s", change.Action, change.FromValue, change.ToValue))
+	}
+	auditIncident(c, user.ID, ActionUpdate, incident, "Updated incident: "+strings.Join(summary, ", "))
+
+	c.JSON(http.StatusOK, incident)
+}
+
+// Move an incident to the next level of the escalation matrix (security team only)
+func handleEscalateIncident(c *gin.Context) {
+	incident, ok := findIncident(c)
+	if !ok {
+		return
+	}
+
+	var req EscalateIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if incident.Status == IncidentStatusClosed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Closed incidents cannot be escalated"})
+		return
+	}
+	if incident.EscalationLevel >= maxEscalationLevel {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incident is already escalated to the CISO"})
+		return
+	}
+
+	user := currentUser(c)
+	from := escalationLevels[incident.EscalationLevel]
+	incident.EscalationLevel++
+	change := IncidentHistory{
+		IncidentID: incident.ID, ActorID: user.ID, Actor: user.Username,
+		Action: IncidentActionEscalated, FromValue: from, ToValue: escalationLevels[incident.EscalationLevel], Note: req.Note,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&incident).Update("escalation_level", incident.EscalationLevel).Error; err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to escalate incident"})
+		return
+	}
+	incident.History = append(incident.History, change)
+
+	auditIncident(c, user.ID, ActionEscalate, incident, fmt.Sprintf("Escalated incident from %s to %s: %s", change.FromValue, change.ToValue, req.Note))
+
+	c.JSON(http.StatusOK, incident)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Chat intents detected from the user's message
+const (
+	IntentPolicyQuestion = "policy_question" // Question answered from policy passages
+	IntentDocumentLookup = "document_lookup" // Request to find or list documents
+	IntentIncidentReport = "incident_report" // User reports a security incident
+	IntentOnboardingStep = "onboarding_step" // Help with an onboarding task
+	IntentSmallTalk      = "small_talk"
+	IntentOutOfScope     = "out_of_scope"
+)
+
+var chatIntents = []string{
+	IntentPolicyQuestion,
+	IntentDocumentLookup,
+	IntentIncidentReport,
+	IntentOnboardingStep,
+	IntentSmallTalk,
+	IntentOutOfScope,
+}
+
+// How an intent was decided
+const (
+	IntentMethodRules   = "rules"
+	IntentMethodLLM     = "llm"
+	IntentMethodHint    = "hint"    // Legacy chat type sent by the client
+	IntentMethodDefault = "default" // Nothing matched, answered from the policies
+	IntentMethodConfirm = "confirm" // Reply confirming the incident the assistant offered to report
+)
+
+// ChatIntent is the classification of a chat message
+type ChatIntent struct {
+	Intent     string  `json:"intent"`
+	Confidence float64 `json:"confidence"` // 0-1
+	Method     string  `json:"method"`
+}
+
+// IntentConfig controls when the LLM is asked to classify a message
+type IntentConfig struct {
+	LLMFallback   bool
+	MinConfidence float64 // Rule results below this go to the LLM when the fallback is enabled
+	LLMTimeout    time.Duration
+}
+
+func loadIntentConfig() IntentConfig {
+	return IntentConfig{
+		LLMFallback:   getEnv("INTENT_LLM_FALLBACK", "false") == "true",
+		MinConfidence: float64(getEnvInt("INTENT_MIN_CONFIDENCE_PERCENT", 50)) / 100,
+		LLMTimeout:    getEnvDuration("INTENT_LLM_TIMEOUT", 5*time.Second),
+	}
+}
+
+// Keyword rule adding weight to one intent
+type intentRule struct {
+	Intent  string
+	Weight  float64
+	Pattern *regexp.Regexp
+}
+
+// Strong phrasings weigh 3, typical keywords 2 and topic words 1
+var intentRules = []intentRule{
+	{IntentIncidentReport, 3, regexp.MustCompile(`(?i)\b(?:i (?:think i )?(?:was|got|have been|'ve been) (?:hacked|phished|scammed|compromised))\b`)},
+	{IntentIncidentReport, 3, regexp.MustCompile(`(?i)\bi (?:think i )?(?:just )?(?:clicked|opened|downloaded|entered my password)\b|\bi(?:'d| would| want to| need to|'m| am) (?:like to )?report(?:ing)?\b`)},
+	{IntentIncidentReport, 3, regexp.MustCompile(`(?i)\b(?:lost|stolen|misplaced) (?:my |a |the )?(?:work |company )?(?:laptop|phone|device|badge|token|yubikey)\b|\bmy (?:account|computer|laptop|password|email) (?:was|has been|is|got) (?:hacked|compromised|stolen|breached)\b`)},
+	{IntentIncidentReport, 3, regexp.MustCompile(`(?i)\b(?:i (?:got|received|have|just got)|someone sent me) (?:an? |this |some )?(?:suspicious|strange|weird|phishing|fake|scam)\b`)},
+	{IntentIncidentReport, 2, regexp.MustCompile(`(?i)\b(?:ransomware|malware|virus|data (?:breach|leak)|security incident|compromised|suspicious (?:email|link|attachment|activity|login|call))\b`)},
+
+	{IntentDocumentLookup, 3, regexp.MustCompile(`(?i)\b(?:find|show|list|search(?: for)?|look up|locate|open|send me|get me|where (?:is|are|can i find))\b[^.?!]{0,30}?\b(?:polic(?:y|ies)|documents?|docs?|guidelines?|standards?|procedures?|handbook|files?)\b`)},
+	{IntentDocumentLookup, 2, regexp.MustCompile(`(?i)\b(?:link to|copy of|download|full text of|which (?:documents?|polic(?:y|ies)))\b`)},
+
+	{IntentOnboardingStep, 3, regexp.MustCompile(`(?i)\b(?:onboarding|new (?:hire|employee|starter|joiner)|first (?:day|week)|getting started|just (?:joined|started))\b`)},
+	{IntentOnboardingStep, 2, regexp.MustCompile(`(?i)\b(?:what should i do (?:next|first)|how do i (?:set ?up|enroll|install|configure|request access|get access))\b|\bset ?up my\b`)},
+	{IntentOnboardingStep, 3, onboardingProgressPattern},
+	{IntentOnboardingStep, 1, regexp.MustCompile(`(?i)\b(?:training|enroll(?:ment)?|mfa|2fa|authenticator)\b`)},
+
+	{IntentPolicyQuestion, 2, regexp.MustCompile(`(?i)\b(?:am i allowed|are we allowed|can i|may i|is it (?:ok|okay|allowed|permitted|safe)|do i (?:need|have) to|must i|should i|what (?:is|are) the (?:rules?|requirements?)|how (?:long|often|many))\b`)},
+	{IntentPolicyQuestion, 2, regexp.MustCompile(`(?i)\b(?:what|how) (?:is|are|does|do)\b[^.?!]{0,30}?\bpolic(?:y|ies)\b|\b(?:according to|under) (?:the|our) \w+ polic(?:y|ies)\b`)},
+	{IntentPolicyQuestion, 1, regexp.MustCompile(`(?i)\b(?:polic(?:y|ies)|passwords?|encrypt\w*|classification|confidential|remote work|byod|usb|e-?mail|phishing|vpn|data|access|compliance|retention|backup|wi-?fi|software)\b`)},
+
+	{IntentSmallTalk, 3, regexp.MustCompile(`(?i)^\s*(?:hi|hello|hey|howdy|good (?:morning|afternoon|evening)|thanks?|thank you|thx|cheers|bye|goodbye|see you|ok(?:ay)?|cool|great|nice)\b[\s,]*(?:there|bot|again|so much|a lot|very much)?[\s!.]*$`)},
+	{IntentSmallTalk, 2, regexp.MustCompile(`(?i)\b(?:how are you|who are you|what are you|what can you do|your name)\b`)},
+
+	{IntentOutOfScope, 3, regexp.MustCompile(`(?i)\b(?:weather|recipe|sports?|football|soccer|stock price|movies?|song|lyrics|poem|joke|horoscope|dating|restaurant)\b`)},
+	{IntentOutOfScope, 2, regexp.MustCompile(`(?i)\b(?:write (?:me )?(?:a|an) (?:poem|story|essay|song)|translate|solve (?:this|my) (?:math|equation)|homework)\b`)},
+}
+
+// Confidence given to a label returned by the LLM or implied by a legacy chat type
+const (
+	llmIntentConfidence  = 0.7
+	hintIntentConfidence = 0.5
+)
+
+// Legacy chat types still sent by older clients
+var chatTypeIntents = map[string]string{
+	"onboarding":    IntentOnboardingStep,
+	"policy_search": IntentDocumentLookup,
+}
+
+// Questions and hypotheticals about incidents, such as "how do I report a
+// phishing email?" or "what should I do if I clicked a link?". They ask about
+// the procedure rather than report anything, so the incident rules skip them.
+var incidentQuestionPattern = regexp.MustCompile(`(?i)^\s*(?:how (?:do|does|should|can|would|to)\b|what (?:should|do|must|would) (?:i|we|you|employees?|staff) do (?:if|when|after|in case)\b|what (?:happens|if)\b|(?:if|in case|suppose|when (?:do|should|must))\b|(?:is|are) (?:it|\w+ing)\b[^.?!]*\b(?:required|mandatory|necessary)\b|who (?:do|should) (?:i|we|you)\b)`)
+
+// The message without the sentences asking about incidents hypothetically
+func incidentReportText(message string) string {
+	var sentences []string
+	for _, sentence := range sentencePattern.FindAllString(message, -1) {
+		if !incidentQuestionPattern.MatchString(sentence) {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return strings.Join(sentences, " ")
+}
+
+// Score a message against the keyword rules. Confidence is the winning intent's
+// share of all matched weight, scaled down when only weak keywords matched.
+func classifyIntentByRules(message string) (ChatIntent, bool) {
+	reportText := incidentReportText(message)
+
+	scores := make(map[string]float64)
+	total := 0.0
+	for _, rule := range intentRules {
+		text := message
+		if rule.Intent == IntentIncidentReport {
+			text = reportText
+		}
+		if rule.Pattern.MatchString(text) {
+			scores[rule.Intent] += rule.Weight
+			total += rule.Weight
+		}
+	}
+	if total == 0 {
+		return ChatIntent{}, false
+	}
+
+	// Ties go to the intent listed first in chatIntents
+	best, bestScore := "", 0.0
+	for _, intent := range chatIntents {
+		if scores[intent] > bestScore {
+			best, bestScore = intent, scores[intent]
+		}
+	}
+
+	strength := bestScore / 3
+	if strength > 1 {
+		strength = 1
+	}
+	return ChatIntent{Intent: best, Confidence: bestScore / total * strength, Method: IntentMethodRules}, true
+}
+
+// Ask the LLM to label a message
+func classifyIntentWithLLM(ctx context.Context, userID uint, message string, timeout time.Duration) (ChatIntent, bool) {
+	temperature, maxTokens := 0.0, 10
+	req := LLMRequest{
+		System: "You classify messages sent to a company IT security assistant. Reply with exactly one label and nothing else.",
+		Prompt: fmt.Sprintf("Labels:\n"+
+			"%s - a question about security rules or what is allowed\n"+
+			"%s - a request to find, list or open policy documents\n"+
+			"%s - the user reports a security incident such as phishing, malware or a lost device\n"+
+			"%s - help with an onboarding task or getting set up\n"+
+			"%s - greetings, thanks or questions about the assistant\n"+
+			"%s - anything unrelated to IT security at work\n\n"+
+			"Message: %s\n\nLabel:",
+			IntentPolicyQuestion, IntentDocumentLookup, IntentIncidentReport,
+			IntentOnboardingStep, IntentSmallTalk, IntentOutOfScope, message),
+		Question:    message,
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	response, err := callModelLLM(ctx, req)
+	if err != nil {
+		return ChatIntent{}, false
+	}
+	recordLLMUsage(userID, req, response)
+
+	label := strings.ToLower(response.Text)
+	for _, intent := range chatIntents {
+		if strings.Contains(label, intent) {
+			return ChatIntent{Intent: intent, Confidence: llmIntentConfidence, Method: IntentMethodLLM}, true
+		}
+	}
+	log.Printf("Intent classification with %s returned no known label: %q", response.Provider, response.Text)
+	return ChatIntent{}, false
+}
+
+// Classify a chat message. Keyword rules decide when they are confident; otherwise
+// the LLM is asked if enabled, then the legacy chat type, and finally the message
+// is treated as a policy question so retrieval can still answer it.
+func classifyChatIntent(ctx context.Context, userID uint, message, chatType string) ChatIntent {
+	config := loadIntentConfig()
+
+	intent, matched := classifyIntentByRules(message)
+	if matched && intent.Confidence >= config.MinConfidence {
+		return intent
+	}
+
+	if config.LLMFallback {
+		if llmIntent, ok := classifyIntentWithLLM(ctx, userID, message, config.LLMTimeout); ok {
+			return llmIntent
+		}
+	}
+
+	if matched {
+		return intent
+	}
+	if hinted, exists := chatTypeIntents[chatType]; exists {
+		return ChatIntent{Intent: hinted, Confidence: hintIntentConfidence, Method: IntentMethodHint}
+	}
+	return ChatIntent{Intent: IntentPolicyQuestion, Method: IntentMethodDefault}
+}
+
+// Classify a message in its conversation: a yes to the assistant's offer to
+// report an incident confirms it, whatever the rules would make of the reply
+func classifyChatTurn(ctx context.Context, userID uint, req ChatRequest, history []ChatMessage) ChatIntent {
+	if _, pending := pendingIncidentReport(history); pending && incidentConfirmationPattern.MatchString(req.Message) {
+		return ChatIntent{Intent: IntentIncidentReport, Confidence: 1, Method: IntentMethodConfirm}
+	}
+	return classifyChatIntent(ctx, userID, req.Message, req.Type)
+}
+
+// Response for intents answered without the LLM. Returns false when the message
+// needs an answer grounded in the policy passages.
+func intentResponse(c *gin.Context, user User, conversationID uint, intent, message string, history []ChatMessage) (ChatResponse, bool) {
+	switch intent {
+	case IntentPolicyQuestion:
+		return ChatResponse{}, false
+	case IntentOnboardingStep:
+		// Progress questions are answered from the user's assignments, the rest from the guides
+		return onboardingChatResponse(user, message)
+	case IntentDocumentLookup:
+		return handlePolicySearch(message), true
+	case IntentIncidentReport:
+		return incidentGuidanceResponse(c, user, conversationID, message, history), true
+	case IntentSmallTalk:
+		return smallTalkResponse(message), true
+	default:
+		return outOfScopeResponse(), true
+	}
+}
+
+// Chat message type of the assistant's offer to report an incident
+const incidentConfirmationType = "incident_confirmation"
+
+// Replies accepting the offer to report an incident
+var incidentConfirmationPattern = regexp.MustCompile(`(?i)^\s*(?:y(?:es|eah|ep|up)|sure|ok(?:ay)?|confirm(?:ed)?|please(?: do)?|go ahead|do it|report it|file it)\b[^?]*$`)
+
+// The user message the assistant last offered to report as an incident, when
+// that offer is the latest message of the conversation
+func pendingIncidentReport(history []ChatMessage) (string, bool) {
+	n := len(history)
+	if n < 2 || history[n-1].Role != MessageRoleAssistant || history[n-1].Type != incidentConfirmationType ||
+		history[n-2].Role != MessageRoleUser {
+		return "", false
+	}
+	return history[n-2].Content, true
+}
+
+// Give the first steps for a reported incident, with the matching response
+// procedures. The incident is only filed once the user confirms; later reports
+// in a conversation with an open incident are added to it straight away.
+func incidentGuidanceResponse(c *gin.Context, user User, conversationID uint, message string, history []ChatMessage) ChatResponse {
+	report := message
+	pending, confirmed := pendingIncidentReport(history)
+	confirmed = confirmed && incidentConfirmationPattern.MatchString(message)
+	if confirmed {
+		report = pending
+	}
+
+	matches := getSearchEngine().Search("incident response "+report, 3)
+
+	var documents []PolicyFile
+	for _, match := range matches {
+		documents = append(documents, match.Document)
+	}
+
+	response := ChatResponse{
+		Response: "It sounds like you may be reporting a security incident. Please act now:\n" +
+			"1. Do not delete anything, and disconnect the affected device from the network if you can.\n" +
+			"2. Do not reply to or forward suspicious messages, and change any password you may have entered.\n",
+		Type:        "incident",
+		PolicyFiles: documents,
+	}
+
+	if !confirmed {
+		open, err := findOpenChatIncident(user, conversationID)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			log.Printf("Failed to look up open incident for user %d: %v", user.ID, err)
+		}
+		if open == nil {
+			response.Response += "3. Should I report this to the IT security team as an incident? Reply \"yes\" and I will file it with what you described.\n" +
+				"The incident response procedures below describe the next steps."
+			response.Type = incidentConfirmationType
+			return response
+		}
+	}
+
+	incident, created, err := fileIncidentFromChat(c, user, conversationID, report)
+	switch {
+	case err != nil:
+		log.Printf("Failed to file incident from chat for user %d: %v", user.ID, err)
+		response.Response += "3. Report it to the IT security team right away with what happened and when.\n" +
+			"The incident response procedures below describe the next steps."
+	case created:
+		response.Response += fmt.Sprintf("3. I have reported this to the IT security team as incident %s (%s, severity %s, handled by %s). "+
+			"They will acknowledge it by %s. Reply in this conversation to add details such as affected devices or accounts.\n"+
+			"The incident response procedures below describe the next steps.",
+			incident.Reference, strings.ReplaceAll(incident.Type, "_", " "), incident.Severity,
+			escalationLevels[incident.EscalationLevel], incident.AcknowledgeDueAt.Format("15:04 on Jan 2"))
+		response.Incident = incident
+	default:
+		response.Response = fmt.Sprintf("Thank you, I have added this to incident %s. The IT security team can see the new details.", incident.Reference)
+		response.Incident = incident
+	}
+	return response
+}
+
+func smallTalkResponse(message string) ChatResponse {
+	lower := strings.ToLower(message)
+	response := "Hello! I'm your IT security assistant. Ask me about security policies, onboarding steps, or report a security incident."
+	switch {
+	case strings.Contains(lower, "thank") || strings.Contains(lower, "thx") || strings.Contains(lower, "cheers"):
+		response = "You're welcome! Let me know if you have any other security questions."
+	case strings.Contains(lower, "bye") || strings.Contains(lower, "see you"):
+		response = "Goodbye! Stay safe online."
+	}
+	return ChatResponse{Response: response, Type: "general"}
+}
+
+func outOfScopeResponse() ChatResponse {
+	return ChatResponse{
+		Response: "I can only help with IT security topics: company security policies, onboarding steps and reporting security incidents. What would you like to know about those?",
+		Type:     "general",
+	}
+}
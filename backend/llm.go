@@ -0,0 +1,682 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LLMRequest is a generation request sent to a provider
+type LLMRequest struct {
+	System         string             // System instructions from the prompt template
+	Prompt         string             // Full prompt, already grounded with policy context
+	Question       string             // Raw user question, used by providers that cannot follow a prompt
+	Temperature    *float64           // Provider default when nil
+	MaxTokens      *int               // Provider default when nil
+	ModelOverrides map[string]string  // Provider name -> model to use instead of the configured one
+	Passages       []RetrievedPassage // Grounding passages in prompt order, for the offline provider
+}
+
+// Model to use for a provider, honouring template overrides
+func (r LLMRequest) modelFor(provider, configured string) string {
+	if model := r.ModelOverrides[provider]; model != "" {
+		return model
+	}
+	return configured
+}
+
+// Prompt with the system instructions inlined, for backends without a system role
+func (r LLMRequest) fullPrompt() string {
+	if r.System == "" {
+		return r.Prompt
+	}
+	return r.System + "\n\n" + r.Prompt
+}
+
+// LLMResponse is the result of a generation
+type LLMResponse struct {
+	Text             string `json:"text"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+}
+
+// LLMModelInfo describes the model behind a provider
+type LLMModelInfo struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Streaming bool   `json:"streaming"` // Native token streaming support
+}
+
+// LLMProvider is implemented by every language model backend
+type LLMProvider interface {
+	Name() string
+	Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+	Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error)
+	Health(ctx context.Context) error
+	ModelInfo() LLMModelInfo
+}
+
+// Provider names accepted in LLM_PROVIDERS
+const (
+	ProviderOllama      = "ollama"
+	ProviderOpenAI      = "openai"
+	ProviderHuggingFace = "huggingface"
+	ProviderMock        = "mock"
+)
+
+// Configured providers in the order they are tried
+var llmProviders []LLMProvider
+
+// Build the provider chain from configuration.
+// LLM_PROVIDERS sets the order (default "ollama,openai,huggingface,mock"); providers
+// missing their required settings are skipped and the mock is always the last resort.
+// Remote providers are wrapped with the timeouts, retries and circuit breaker of their policy,
+// and those outside the local network also get PII and secret redaction.
+func initLLMProviders() []LLMProvider {
+	if os.Getenv("AI_ENABLED") != "true" {
+		return []LLMProvider{newMockProvider()}
+	}
+
+	order := getEnv("LLM_PROVIDERS", "ollama,openai,huggingface,mock")
+
+	var providers []LLMProvider
+	hasMock := false
+	for _, name := range strings.Split(order, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		provider, err := newLLMProvider(name)
+		if err != nil {
+			log.Printf("   ⚠️  Skipping LLM provider %q: %v", name, err)
+			continue
+		}
+		if name == ProviderMock {
+			hasMock = true
+		} else {
+			if shouldRedact(provider) {
+				provider = newRedactingProvider(provider)
+			}
+			provider = newResilientProvider(provider, loadProviderPolicy(name))
+		}
+		providers = append(providers, provider)
+	}
+
+	if !hasMock {
+		providers = append(providers, newMockProvider())
+	}
+
+	return providers
+}
+
+func newLLMProvider(name string) (LLMProvider, error) {
+	switch name {
+	case ProviderOllama:
+		return newOllamaProvider()
+	case ProviderOpenAI:
+		return newOpenAIProvider()
+	case ProviderHuggingFace:
+		return newHuggingFaceProvider()
+	case ProviderMock:
+		return newMockProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown provider")
+	}
+}
+
+// Generate a response with the first provider that succeeds, in configured order
+func callLLM(ctx context.Context, req LLMRequest) *LLMResponse {
+	for _, provider := range llmProviders {
+		response, err := provider.Generate(ctx, req)
+		if err == nil {
+			log.Printf("✅ Using %s (%s)", provider.Name(), response.Model)
+			return response
+		}
+		if err == ErrCircuitOpen {
+			continue
+		}
+		log.Printf("⚠️  LLM provider %s failed: %v", provider.Name(), err)
+	}
+
+	// Only reachable if every provider, including the mock, failed
+	response, _ := newMockProvider().Generate(ctx, req)
+	return response
+}
+
+// ErrNoLLMProvider is returned when no real model could generate a response
+var ErrNoLLMProvider = errors.New("no LLM provider available")
+
+// Generate a response with the first real provider that succeeds. Unlike callLLM the
+// mock is skipped, for tasks such as classification or drafting that need a model.
+func callModelLLM(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	for _, provider := range llmProviders {
+		if provider.Name() == ProviderMock {
+			continue
+		}
+		response, err := provider.Generate(ctx, req)
+		if err == nil {
+			return response, nil
+		}
+		if err != ErrCircuitOpen {
+			log.Printf("⚠️  LLM provider %s failed: %v", provider.Name(), err)
+		}
+	}
+	return nil, ErrNoLLMProvider
+}
+
+// Stream a response, moving to the next provider only while nothing has been sent to the client
+func streamLLM(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	for _, provider := range llmProviders {
+		sent := false
+		response, err := provider.Stream(ctx, req, func(token string) error {
+			sent = true
+			return onToken(token)
+		})
+		if err == nil {
+			log.Printf("✅ Streaming from %s (%s)", provider.Name(), response.Model)
+			return response, nil
+		}
+		if sent || ctx.Err() != nil {
+			return response, err
+		}
+		if err == ErrCircuitOpen {
+			continue
+		}
+		log.Printf("⚠️  LLM provider %s failed to stream: %v", provider.Name(), err)
+	}
+
+	response, _ := newMockProvider().Generate(ctx, req)
+	return response, onToken(response.Text)
+}
+
+// Shared HTTP helpers
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}, headers map[string]string) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &LLMHTTPError{URL: url, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(message))}
+	}
+
+	return resp, nil
+}
+
+func getHealth(ctx context.Context, client *http.Client, url string, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &LLMHTTPError{URL: url, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Ollama provider (preferred - from Google Colab)
+
+type ollamaProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func newOllamaProvider() (*ollamaProvider, error) {
+	baseURL := os.Getenv("OLLAMA_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("OLLAMA_URL not configured")
+	}
+
+	return &ollamaProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   getEnv("OLLAMA_MODEL", "llama3.1:8b"),
+		client:  newLLMHTTPClient(),
+	}, nil
+}
+
+func (p *ollamaProvider) Name() string { return ProviderOllama }
+
+func (p *ollamaProvider) ModelInfo() LLMModelInfo {
+	return LLMModelInfo{Provider: ProviderOllama, Model: p.model, Endpoint: p.baseURL, Streaming: true}
+}
+
+func (p *ollamaProvider) Health(ctx context.Context) error {
+	return getHealth(ctx, p.client, p.baseURL+"/api/tags", nil)
+}
+
+func (p *ollamaProvider) request(req LLMRequest, stream bool) OllamaRequest {
+	ollamaRequest := OllamaRequest{
+		Model:  req.modelFor(ProviderOllama, p.model),
+		System: req.System,
+		Prompt: req.Prompt,
+		Stream: stream,
+	}
+	if req.Temperature != nil || req.MaxTokens != nil {
+		ollamaRequest.Options = map[string]interface{}{}
+		if req.Temperature != nil {
+			ollamaRequest.Options["temperature"] = *req.Temperature
+		}
+		if req.MaxTokens != nil {
+			ollamaRequest.Options["num_predict"] = *req.MaxTokens
+		}
+	}
+	return ollamaRequest
+}
+
+func (p *ollamaProvider) Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	ollamaRequest := p.request(req, false)
+	resp, err := postJSON(ctx, p.client, p.baseURL+"/api/generate", ollamaRequest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResponse OllamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResponse); err != nil {
+		return nil, err
+	}
+
+	return &LLMResponse{
+		Text:             ollamaResponse.Response,
+		Provider:         ProviderOllama,
+		Model:            ollamaRequest.Model,
+		PromptTokens:     ollamaResponse.PromptEvalCount,
+		CompletionTokens: ollamaResponse.EvalCount,
+	}, nil
+}
+
+// Relay Ollama's NDJSON token stream
+func (p *ollamaProvider) Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	ollamaRequest := p.request(req, true)
+	resp, err := postJSON(ctx, p.client, p.baseURL+"/api/generate", ollamaRequest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &LLMResponse{Provider: ProviderOllama, Model: ollamaRequest.Model}
+	var text strings.Builder
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var chunk OllamaResponse
+			if jsonErr := json.Unmarshal(line, &chunk); jsonErr != nil {
+				result.Text = text.String()
+				return result, fmt.Errorf("invalid stream chunk: %v", jsonErr)
+			}
+			if chunk.Response != "" {
+				text.WriteString(chunk.Response)
+				if err := onToken(chunk.Response); err != nil {
+					result.Text = text.String()
+					return result, err
+				}
+			}
+			if chunk.Done {
+				result.Text = text.String()
+				result.PromptTokens = chunk.PromptEvalCount
+				result.CompletionTokens = chunk.EvalCount
+				return result, nil
+			}
+		}
+		if err != nil {
+			result.Text = text.String()
+			if err == io.EOF {
+				return result, fmt.Errorf("ollama stream ended before completion")
+			}
+			return result, err
+		}
+	}
+}
+
+// OpenAI-compatible provider (vLLM, llama.cpp server, LM Studio, OpenAI)
+
+type openAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Stream      bool            `json:"stream"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage,omitempty"`
+}
+
+func newOpenAIProvider() (*openAIProvider, error) {
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("OPENAI_BASE_URL not configured")
+	}
+
+	model := os.Getenv("OPENAI_MODEL")
+	if model == "" {
+		return nil, fmt.Errorf("OPENAI_MODEL not configured")
+	}
+
+	return &openAIProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  os.Getenv("OPENAI_API_KEY"),
+		model:   model,
+		client:  newLLMHTTPClient(),
+	}, nil
+}
+
+func (p *openAIProvider) Name() string { return ProviderOpenAI }
+
+func (p *openAIProvider) ModelInfo() LLMModelInfo {
+	return LLMModelInfo{Provider: ProviderOpenAI, Model: p.model, Endpoint: p.baseURL, Streaming: true}
+}
+
+func (p *openAIProvider) headers() map[string]string {
+	if p.apiKey == "" {
+		return nil // Local servers usually run without authentication
+	}
+	return map[string]string{"Authorization": "Bearer " + p.apiKey}
+}
+
+func (p *openAIProvider) Health(ctx context.Context) error {
+	return getHealth(ctx, p.client, p.baseURL+"/models", p.headers())
+}
+
+func (p *openAIProvider) chatRequest(req LLMRequest, stream bool) openAIChatRequest {
+	var messages []openAIMessage
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	messages = append(messages, openAIMessage{Role: "user", Content: req.Prompt})
+
+	return openAIChatRequest{
+		Model:       req.modelFor(ProviderOpenAI, p.model),
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+}
+
+func (p *openAIProvider) Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	chatRequest := p.chatRequest(req, false)
+	resp, err := postJSON(ctx, p.client, p.baseURL+"/chat/completions", chatRequest, p.headers())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chatResponse openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
+		return nil, err
+	}
+	if len(chatResponse.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	result := &LLMResponse{
+		Text:     chatResponse.Choices[0].Message.Content,
+		Provider: ProviderOpenAI,
+		Model:    chatRequest.Model,
+	}
+	if chatResponse.Usage != nil {
+		result.PromptTokens = chatResponse.Usage.PromptTokens
+		result.CompletionTokens = chatResponse.Usage.CompletionTokens
+	}
+	return result, nil
+}
+
+// Relay the "data: {...}" Server-Sent Events of /chat/completions
+func (p *openAIProvider) Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	chatRequest := p.chatRequest(req, true)
+	resp, err := postJSON(ctx, p.client, p.baseURL+"/chat/completions", chatRequest, p.headers())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &LLMResponse{Provider: ProviderOpenAI, Model: chatRequest.Model}
+	var text strings.Builder
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		data := strings.TrimSpace(string(line))
+		if strings.HasPrefix(data, "data:") {
+			data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+			if data == "[DONE]" {
+				result.Text = text.String()
+				return result, nil
+			}
+
+			var chunk openAIChatResponse
+			if jsonErr := json.Unmarshal([]byte(data), &chunk); jsonErr != nil {
+				result.Text = text.String()
+				return result, fmt.Errorf("invalid stream chunk: %v", jsonErr)
+			}
+			if chunk.Usage != nil {
+				result.PromptTokens = chunk.Usage.PromptTokens
+				result.CompletionTokens = chunk.Usage.CompletionTokens
+			}
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				token := chunk.Choices[0].Delta.Content
+				text.WriteString(token)
+				if err := onToken(token); err != nil {
+					result.Text = text.String()
+					return result, err
+				}
+			}
+		}
+		if err != nil {
+			result.Text = text.String()
+			if err == io.EOF {
+				// Some servers close the stream without a [DONE] marker
+				return result, nil
+			}
+			return result, err
+		}
+	}
+}
+
+// Hugging Face Inference API provider (fallback)
+
+type huggingFaceProvider struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+func newHuggingFaceProvider() (*huggingFaceProvider, error) {
+	token := os.Getenv("HF_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("HF_TOKEN not configured")
+	}
+
+	return &huggingFaceProvider{
+		apiURL: getEnv("HF_API_URL", HF_API_URL),
+		token:  token,
+		client: newLLMHTTPClient(),
+	}, nil
+}
+
+func (p *huggingFaceProvider) Name() string { return ProviderHuggingFace }
+
+func (p *huggingFaceProvider) ModelInfo() LLMModelInfo {
+	model := p.apiURL
+	if i := strings.Index(model, "/models/"); i >= 0 {
+		model = model[i+len("/models/"):]
+	}
+	return LLMModelInfo{Provider: ProviderHuggingFace, Model: model, Endpoint: p.apiURL, Streaming: false}
+}
+
+func (p *huggingFaceProvider) headers() map[string]string {
+	return map[string]string{"Authorization": "Bearer " + p.token}
+}
+
+func (p *huggingFaceProvider) Health(ctx context.Context) error {
+	return getHealth(ctx, p.client, p.apiURL, p.headers())
+}
+
+func (p *huggingFaceProvider) Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	maxLength, temperature := 200, 0.7
+	if req.MaxTokens != nil {
+		maxLength = *req.MaxTokens
+	}
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	resp, err := postJSON(ctx, p.client, p.apiURL, HFRequest{
+		Inputs: req.fullPrompt(),
+		Parameters: map[string]interface{}{
+			"max_length":   maxLength,
+			"temperature":  temperature,
+			"do_sample":    true,
+			"pad_token_id": 50256,
+		},
+	}, p.headers())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var hfResponse HFResponse
+	if err := json.NewDecoder(resp.Body).Decode(&hfResponse); err != nil {
+		return nil, err
+	}
+
+	text := "I'm sorry, I couldn't generate a response."
+	if len(hfResponse) > 0 {
+		text = hfResponse[0].GeneratedText
+	}
+
+	return &LLMResponse{Text: text, Provider: ProviderHuggingFace, Model: p.ModelInfo().Model}, nil
+}
+
+// The Inference API has no token streaming, so the full answer is sent as one token
+func (p *huggingFaceProvider) Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	response, err := p.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return response, onToken(response.Text)
+}
+
+// Provider status for the admin endpoint
+type LLMProviderStatus struct {
+	LLMModelInfo
+	Circuit   *CircuitStatus `json:"circuit,omitempty"`
+	Redaction bool           `json:"redaction"` // PII and secrets are removed from prompts
+	Healthy   bool           `json:"healthy"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Provider availability for the public health check, without contacting the
+// backends. Models, endpoints and upstream errors are only reported to admins.
+type LLMProviderState struct {
+	Provider string `json:"provider"`
+	Healthy  bool   `json:"healthy"` // False while the circuit breaker is open
+}
+
+// Whether a configured provider redacts prompts
+func isRedacting(provider LLMProvider) bool {
+	if resilient, ok := provider.(*resilientProvider); ok {
+		provider = resilient.LLMProvider
+	}
+	_, ok := provider.(*redactingProvider)
+	return ok
+}
+
+func llmProviderStates() []LLMProviderState {
+	var states []LLMProviderState
+	for _, provider := range llmProviders {
+		state := LLMProviderState{Provider: provider.Name(), Healthy: true}
+		if resilient, ok := provider.(*resilientProvider); ok {
+			state.Healthy = resilient.Circuit().State != CircuitOpen
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// Report configured providers and their live health (admin only)
+func handleGetLLMProviders(c *gin.Context) {
+	var statuses []LLMProviderStatus
+	for _, provider := range llmProviders {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		status := LLMProviderStatus{LLMModelInfo: provider.ModelInfo(), Redaction: isRedacting(provider), Healthy: true}
+		if resilient, ok := provider.(*resilientProvider); ok {
+			circuit := resilient.Circuit()
+			status.Circuit = &circuit
+		}
+		err := provider.Health(ctx)
+		cancel()
+		if err != nil {
+			status.Healthy = false
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"providers": statuses})
+}
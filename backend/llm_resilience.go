@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProviderPolicy holds timeout, retry and circuit breaker settings for one provider
+type ProviderPolicy struct {
+	Timeout          time.Duration // Per attempt, for blocking generations
+	StreamTimeout    time.Duration // Per attempt, for streamed generations
+	MaxRetries       int           // Extra attempts after a transient failure
+	RetryBackoff     time.Duration // Base delay, doubled on every retry
+	FailureThreshold int           // Consecutive failures that open the circuit
+	Cooldown         time.Duration // How long an open circuit skips the provider
+}
+
+// LLMHTTPError is returned when a provider answers with a non-2xx status
+type LLMHTTPError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *LLMHTTPError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// ErrCircuitOpen is returned while a provider is being skipped after repeated failures
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// Load the policy for a provider. LLM_<NAME>_<SETTING> overrides LLM_<SETTING>,
+// e.g. LLM_OLLAMA_TIMEOUT=90s takes precedence over LLM_TIMEOUT=30s.
+func loadProviderPolicy(name string) ProviderPolicy {
+	prefix := "LLM_" + strings.ToUpper(name) + "_"
+	duration := func(setting string, defaultValue time.Duration) time.Duration {
+		return getEnvDuration(prefix+setting, getEnvDuration("LLM_"+setting, defaultValue))
+	}
+	integer := func(setting string, defaultValue int) int {
+		return getEnvInt(prefix+setting, getEnvInt("LLM_"+setting, defaultValue))
+	}
+
+	return ProviderPolicy{
+		Timeout:          duration("TIMEOUT", 60*time.Second),
+		StreamTimeout:    duration("STREAM_TIMEOUT", 3*time.Minute),
+		MaxRetries:       integer("MAX_RETRIES", 2),
+		RetryBackoff:     duration("RETRY_BACKOFF", 500*time.Millisecond),
+		FailureThreshold: integer("FAILURE_THRESHOLD", 3),
+		Cooldown:         duration("COOLDOWN", 5*time.Minute),
+	}
+}
+
+// HTTP client for LLM backends. Overall deadlines come from the request context,
+// so only connection setup is bounded here.
+func newLLMHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// Whether an error is worth retrying
+func isTransientLLMError(err error) bool {
+	var httpErr *LLMHTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// Circuit breaker that skips a provider for a cooldown period after repeated failures
+type circuitBreaker struct {
+	mu               sync.Mutex
+	threshold        int
+	cooldown         time.Duration
+	state            string
+	failures         int
+	openedAt         time.Time
+	lastError        string
+	halfOpenInFlight bool
+}
+
+// Circuit breaker snapshot reported on the health endpoints
+type CircuitStatus struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"consecutive_failures"`
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: CircuitClosed}
+}
+
+// Allow reports whether a call may go through. After the cooldown a single trial call is let through.
+func (cb *circuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.halfOpenInFlight = true
+		return true
+	case CircuitHalfOpen:
+		if cb.halfOpenInFlight {
+			return false
+		}
+		cb.halfOpenInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *circuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = CircuitClosed
+	cb.failures = 0
+	cb.halfOpenInFlight = false
+}
+
+func (cb *circuitBreaker) RecordFailure(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.lastError = err.Error()
+	cb.halfOpenInFlight = false
+
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// Release a trial slot without judging the provider (e.g. the client went away)
+func (cb *circuitBreaker) RecordCancelled() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.halfOpenInFlight = false
+	}
+}
+
+func (cb *circuitBreaker) Status() CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := CircuitStatus{State: cb.state, Failures: cb.failures, LastError: cb.lastError}
+	if cb.state == CircuitOpen {
+		openUntil := cb.openedAt.Add(cb.cooldown)
+		status.OpenUntil = &openUntil
+	}
+	return status
+}
+
+// resilientProvider wraps a provider with timeouts, retries and a circuit breaker
+type resilientProvider struct {
+	LLMProvider
+	policy  ProviderPolicy
+	breaker *circuitBreaker
+}
+
+func newResilientProvider(provider LLMProvider, policy ProviderPolicy) *resilientProvider {
+	return &resilientProvider{
+		LLMProvider: provider,
+		policy:      policy,
+		breaker:     newCircuitBreaker(policy.FailureThreshold, policy.Cooldown),
+	}
+}
+
+func (p *resilientProvider) Circuit() CircuitStatus {
+	return p.breaker.Status()
+}
+
+func (p *resilientProvider) Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	if !p.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= p.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := p.backoff(ctx, attempt); err != nil {
+				break
+			}
+			log.Printf("🔁 Retrying %s (attempt %d/%d) after: %v", p.Name(), attempt+1, p.policy.MaxRetries+1, lastErr)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, p.policy.Timeout)
+		response, err := p.LLMProvider.Generate(attemptCtx, req)
+		cancel()
+
+		if err == nil {
+			p.breaker.RecordSuccess()
+			return response, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil || !isTransientLLMError(err) {
+			break
+		}
+	}
+
+	p.recordError(ctx, lastErr)
+	return nil, lastErr
+}
+
+// Streams are only retried while no token has reached the caller
+func (p *resilientProvider) Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	if !p.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	var lastErr error
+	var lastResponse *LLMResponse
+	for attempt := 0; attempt <= p.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := p.backoff(ctx, attempt); err != nil {
+				break
+			}
+			log.Printf("🔁 Retrying %s stream (attempt %d/%d) after: %v", p.Name(), attempt+1, p.policy.MaxRetries+1, lastErr)
+		}
+
+		sent := false
+		attemptCtx, cancel := context.WithTimeout(ctx, p.policy.StreamTimeout)
+		response, err := p.LLMProvider.Stream(attemptCtx, req, func(token string) error {
+			sent = true
+			return onToken(token)
+		})
+		cancel()
+
+		if err == nil {
+			p.breaker.RecordSuccess()
+			return response, nil
+		}
+		lastErr, lastResponse = err, response
+
+		if sent || ctx.Err() != nil || !isTransientLLMError(err) {
+			break
+		}
+	}
+
+	p.recordError(ctx, lastErr)
+	return lastResponse, lastErr
+}
+
+func (p *resilientProvider) recordError(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		p.breaker.RecordCancelled()
+		return
+	}
+
+	p.breaker.RecordFailure(err)
+	if status := p.breaker.Status(); status.State == CircuitOpen {
+		log.Printf("🚫 Circuit open for %s until %s: %v", p.Name(), status.OpenUntil.Format(time.RFC3339), err)
+	}
+}
+
+// Wait before the next attempt with exponential backoff and jitter
+func (p *resilientProvider) backoff(ctx context.Context, attempt int) error {
+	delay := p.policy.RetryBackoff << (attempt - 1)
+	if delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
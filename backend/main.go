@@ -2,17 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,14 +32,18 @@ import (
 
 // Ollama API structures for Google Colab integration
 type OllamaRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
+	Model   string                 `json:"model"`
+	System  string                 `json:"system,omitempty"`
+	Prompt  string                 `json:"prompt"`
+	Stream  bool                   `json:"stream"`
+	Options map[string]interface{} `json:"options,omitempty"` // e.g. temperature, num_predict
 }
 
 type OllamaResponse struct {
-	Response string `json:"response"`
-	Done     bool   `json:"done"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count,omitempty"` // Only set on the final chunk
+	EvalCount       int    `json:"eval_count,omitempty"`
 }
 
 // Hugging Face API structures for free inference
@@ -53,14 +57,33 @@ type HFResponse []struct {
 }
 
 type ChatRequest struct {
-	Message string `json:"message"`
-	Type    string `json:"type"` // "onboarding" or "policy_search"
+	Message        string `json:"message"`
+	Type           string `json:"type,omitempty"`            // Deprecated: intent is classified by the server; only used as a hint
+	ConversationID *uint  `json:"conversation_id,omitempty"` // Omit to start a new conversation
 }
 
 type ChatResponse struct {
-	Response    string       `json:"response"`
-	Type        string       `json:"type"`
-	PolicyFiles []PolicyFile `json:"policy_files,omitempty"`
+	Response         string             `json:"response"`
+	Type             string             `json:"type"`
+	ConversationID   uint               `json:"conversation_id,omitempty"`
+	MessageID        uint               `json:"message_id,omitempty"` // Persisted assistant message
+	Provider         string             `json:"provider,omitempty"`   // LLM provider that generated the answer
+	Model            string             `json:"model,omitempty"`
+	Cached           bool               `json:"cached,omitempty"` // Answer served from the answer cache
+	Intent           string             `json:"intent,omitempty"` // Detected intent the message was routed by
+	IntentConfidence float64            `json:"intent_confidence"`
+	PromptTemplate   *PromptTemplateRef `json:"prompt_template,omitempty"` // Template version that produced the answer
+	PolicyFiles      []PolicyFile       `json:"policy_files,omitempty"`
+	Sources          []ChatSource       `json:"sources,omitempty"` // Passages given to the LLM
+	Citations        []Citation         `json:"citations,omitempty"`
+	Incident         *Incident          `json:"incident,omitempty"` // Incident filed from the message
+}
+
+// Identifies the prompt template version used for a chat answer
+type PromptTemplateRef struct {
+	ID      uint   `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
 }
 
 // Enhanced PolicyFile structure for better document management with GORM tags
@@ -104,12 +127,17 @@ type AuditLog struct {
 
 // Audit action constants
 const (
-	ActionCreate = "CREATE"
-	ActionUpdate = "UPDATE"
-	ActionDelete = "DELETE"
-	ActionView   = "VIEW"
-	ActionLogin  = "LOGIN"
-	ActionLogout = "LOGOUT"
+	ActionCreate   = "CREATE"
+	ActionUpdate   = "UPDATE"
+	ActionDelete   = "DELETE"
+	ActionView     = "VIEW"
+	ActionLogin    = "LOGIN"
+	ActionLogout   = "LOGOUT"
+	ActionBlock    = "BLOCK"    // Guardrail rejected a chat message or passage
+	ActionSanitize = "SANITIZE" // Guardrail removed injected text
+	ActionFlag     = "FLAG"     // Guardrail recorded a finding without intervening
+	ActionEscalate = "ESCALATE" // Incident moved up the escalation matrix
+	ActionExport   = "EXPORT"   // Transcript or report downloaded
 )
 
 // Resource type constants
@@ -117,6 +145,14 @@ const (
 	ResourceUser     = "USER"
 	ResourceDocument = "DOCUMENT"
 	ResourceSystem   = "SYSTEM"
+	ResourceConversation = "CONVERSATION"
+	ResourcePromptTemplate = "PROMPT_TEMPLATE"
+	ResourceFeedback = "FEEDBACK"
+	ResourceGuardrail = "GUARDRAIL"
+	ResourceOnboarding = "ONBOARDING"
+	ResourceAcknowledgement = "ACKNOWLEDGEMENT"
+	ResourceQuiz = "QUIZ"
+	ResourceIncident = "INCIDENT"
 )
 
 // PolicyFile model (updated to include user relationship)
@@ -136,6 +172,8 @@ type PolicyFile struct {
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	LastUpdated string    `json:"last_updated" gorm:"-"` // Computed field for compatibility
 	IsActive    bool      `json:"is_active" gorm:"default:true;index"`
+	Version     int       `json:"version" gorm:"not null;default:1"` // Incremented whenever the content changes
+	RequiresAcknowledgement bool `json:"requires_acknowledgement" gorm:"default:false;index"` // Employees must attest to each version
 }
 
 // Request structures for document management
@@ -148,6 +186,7 @@ type CreateDocumentRequest struct {
 	Tags         []string `json:"tags"`
 	CreatedBy    string   `json:"created_by"`
 	FilePath     string   `json:"file_path,omitempty"` // Path to original uploaded file
+	RequiresAcknowledgement bool `json:"requires_acknowledgement"`
 }
 
 type UpdateDocumentRequest struct {
@@ -158,6 +197,7 @@ type UpdateDocumentRequest struct {
 	DocumentType string   `json:"document_type"`
 	Tags         []string `json:"tags"`
 	IsActive     *bool    `json:"is_active"`
+	RequiresAcknowledgement *bool `json:"requires_acknowledgement"`
 }
 
 // Authentication request structures
@@ -205,24 +245,40 @@ type DocumentMatch struct {
 	Document PolicyFile `json:"document"`
 	Score    float64    `json:"score"`
 	Matches  []Match    `json:"matches"`
+	Snippets []SearchSnippet `json:"snippets,omitempty"` // Content and description excerpts around the matches
 }
 
 type Match struct {
 	Field   string `json:"field"`
 	Text    string `json:"text"`
 	Score   float64 `json:"score"`
+	Span    *MatchSpan `json:"span,omitempty"` // Where a phrase or a close group of query terms occurs
+
+	// Word positions of the span in the field, resolved to a MatchSpan for returned results
+	firstWord, lastWord int
+	hasSpan             bool
+	phrase              bool // Text is a phrase to highlight as a whole
+}
+
+// Character range of a match within its field's text
+type MatchSpan struct {
+	Start int    `json:"start"` // Character offsets into the field text
+	End   int    `json:"end"`
+	Text  string `json:"text"`
 }
 
-type SearchEngine struct {
-	Documents []PolicyFile
-	Index     map[string][]DocumentIndex // word -> document indices
+// Excerpt of a document field with the matched words highlighted
+type SearchSnippet struct {
+	Field      string          `json:"field"`
+	Text       string          `json:"text"`  // Matched words are wrapped in the configured highlight markers
+	Start      int             `json:"start"` // Character offsets of the excerpt in the field text
+	End        int             `json:"end"`
+	Highlights []SnippetRange  `json:"highlights"` // Character offsets of the highlighted words in the field text
 }
 
-type DocumentIndex struct {
-	DocumentID int
-	Field      string
-	Frequency  int
-	Positions  []int
+type SnippetRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 // File upload structures
@@ -431,7 +487,7 @@ func connectDB() (*gorm.DB, error) {
 	}
 
 	// Auto-migrate the schema
-	err = database.AutoMigrate(&User{}, &PolicyFile{}, &AuditLog{})
+	err = database.AutoMigrate(&User{}, &PolicyFile{}, &AuditLog{}, &Conversation{}, &ChatMessage{}, &PromptTemplate{}, &ChatFeedback{}, &LLMUsage{}, &OnboardingProgram{}, &OnboardingStep{}, &OnboardingAssignment{}, &OnboardingProgress{}, &PolicyAcknowledgement{}, &Quiz{}, &QuizQuestion{}, &QuizAttempt{}, &Incident{}, &IncidentHistory{})
 	if err != nil {
 		return nil, err
 	}
@@ -447,6 +503,39 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// Get integer environment variable with default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// Get duration environment variable (e.g. "30s", "5m") with default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// Get floating-point environment variable with default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid number for %s: %q, using default %g", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
 // File upload and processing utilities
 
 // Save uploaded file to disk and return the file path
@@ -761,12 +850,20 @@ func initializeDatabase() error {
 		}
 	}
 
+	// Seed the default chat prompt template
+	if err := seedPromptTemplates(); err != nil {
+		return err
+	}
+
 	// Check if policy data already exists
 	var policyCount int64
 	db.Model(&PolicyFile{}).Count(&policyCount)
 	if policyCount > 0 {
 		log.Println("Database already contains policy data, skipping policy initialization")
-		return nil
+		if err := seedAcknowledgementPolicies(); err != nil {
+			return err
+		}
+		return seedOnboardingPrograms()
 	}
 
 	// Sample policy data
@@ -781,6 +878,7 @@ func initializeDatabase() error {
 		CreatedBy:    "IT Security Team",
 		CreatedByUserID: &adminUser.ID,
 		IsActive:     true,
+		RequiresAcknowledgement: true,
 	},
 	{
 		Name:         "Data Classification Policy",
@@ -792,6 +890,7 @@ func initializeDatabase() error {
 		CreatedBy:    "Data Protection Officer",
 		CreatedByUserID: &adminUser.ID,
 		IsActive:     true,
+		RequiresAcknowledgement: true,
 	},
 	{
 		Name:         "Remote Work Security Policy",
@@ -803,6 +902,7 @@ func initializeDatabase() error {
 		CreatedBy:    "IT Operations",
 		CreatedByUserID: &adminUser.ID,
 		IsActive:     true,
+		RequiresAcknowledgement: true,
 	},
 	{
 		Name:         "Incident Response Policy",
@@ -848,7 +948,9 @@ func initializeDatabase() error {
 	}
 
 	log.Printf("Successfully initialized database with %d documents", len(samplePolicies))
-	return nil
+
+	// Build the default onboarding program from the sample documents
+	return seedOnboardingPrograms()
 }
 
 // Authentication middleware
@@ -920,178 +1022,6 @@ func requireRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
-// Initialize search engine with database
-func NewSearchEngine() *SearchEngine {
-	var documents []PolicyFile
-	db.Find(&documents)
-	
-	engine := &SearchEngine{
-		Documents: documents,
-		Index:     make(map[string][]DocumentIndex),
-	}
-	engine.BuildIndex()
-	return engine
-}
-
-// Function to call Ollama API (preferred - from Google Colab)
-func callOllamaAPI(prompt string) (string, error) {
-	ollamaURL := os.Getenv("OLLAMA_URL")
-	if ollamaURL == "" {
-		return "", fmt.Errorf("OLLAMA_URL not configured")
-	}
-
-	// Create context-aware prompt for security chatbot
-	securityPrompt := fmt.Sprintf(`You are an IT security assistant for company onboarding. 
-
-Context: You help new employees understand security policies including passwords, VPN, data protection, and incident response.
-
-Employee Question: %s
-
-Provide a helpful, professional response about IT security. Keep it concise and actionable.`, prompt)
-
-	requestBody := OllamaRequest{
-		Model:  "llama3.1:8b",
-		Prompt: securityPrompt,
-		Stream: false,
-	}
-
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST", ollamaURL+"/api/generate", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	var ollamaResponse OllamaResponse
-	err = json.Unmarshal(body, &ollamaResponse)
-	if err != nil {
-		return "", err
-	}
-
-	return ollamaResponse.Response, nil
-}
-
-// Function to call Hugging Face Inference API (fallback)
-func callHuggingFaceAPI(prompt string) (string, error) {
-	hfToken := os.Getenv("HF_TOKEN")
-	if hfToken == "" {
-		return "", fmt.Errorf("HF_TOKEN not configured")
-	}
-
-	requestBody := HFRequest{
-		Inputs: prompt,
-		Parameters: map[string]interface{}{
-			"max_length":   200,
-			"temperature":  0.7,
-			"do_sample":    true,
-			"pad_token_id": 50256,
-		},
-	}
-
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST", HF_API_URL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+hfToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	var hfResponse HFResponse
-	err = json.Unmarshal(body, &hfResponse)
-	if err != nil {
-		return "", err
-	}
-
-	if len(hfResponse) > 0 {
-		return hfResponse[0].GeneratedText, nil
-	}
-
-	return "I'm sorry, I couldn't generate a response.", nil
-}
-
-// Smart LLM caller that tries Ollama first, then HF, then mock
-func callLLM(prompt string) string {
-	// Check if AI features are enabled
-	aiEnabled := os.Getenv("AI_ENABLED")
-	if aiEnabled != "true" {
-		log.Println("🤖 AI features disabled, using mock responses")
-		return generateMockLLMResponse(prompt)
-	}
-
-	// Try Ollama first (Google Colab)
-	if response, err := callOllamaAPI(prompt); err == nil {
-		log.Println("✅ Using Ollama API from Google Colab")
-		return response
-	}
-
-	// Fallback to Hugging Face
-	if response, err := callHuggingFaceAPI(prompt); err == nil {
-		log.Println("✅ Using Hugging Face API")
-		return response
-	}
-
-	// Final fallback to mock responses
-	log.Println("ℹ️  Using mock responses (no API configured)")
-	return generateMockLLMResponse(prompt)
-}
-
-// Mock LLM response for testing without API
-func generateMockLLMResponse(prompt string) string {
-	prompt = strings.ToLower(prompt)
-
-	if strings.Contains(prompt, "password") {
-		return "Our password policy requires at least 12 characters with uppercase, lowercase, numbers, and special characters. Passwords must be changed every 90 days. Would you like me to show you the complete policy document?"
-	}
-
-	if strings.Contains(prompt, "vpn") {
-		return "For remote work, you must use our company VPN. Make sure your device is encrypted and follow secure Wi-Fi practices. Personal devices need MDM enrollment."
-	}
-
-	if strings.Contains(prompt, "incident") {
-		return "Security incidents must be reported within 2 hours. Follow our escalation process: Level 1 (Help Desk) → Level 2 (Security Team) → Level 3 (CISO). Document all actions taken."
-	}
-
-	if strings.Contains(prompt, "data") {
-		return "All company data must be classified as Public, Internal, Confidential, or Restricted. Confidential and Restricted data requires encryption at rest and in transit."
-	}
-
-	return "I can help you with IT security questions including passwords, VPN access, data protection, and incident response. What would you like to know?"
-}
-
 // Authentication handlers
 func handleRegister(c *gin.Context) {
 	var req RegisterRequest
@@ -1139,6 +1069,11 @@ func handleRegister(c *gin.Context) {
 	// Log user registration activity
 	logSystemActivity(c, user.ID, ActionCreate, fmt.Sprintf("New user registered: %s %s (%s)", user.FirstName, user.LastName, user.Username))
 
+	// Enroll the new user in the onboarding programs for their role
+	if _, err := assignOnboardingPrograms(user); err != nil {
+		log.Printf("Failed to assign onboarding programs to user %d: %v", user.ID, err)
+	}
+
 	// Generate JWT token
 	token, expiresAt, err := generateJWT(user)
 	if err != nil {
@@ -1410,6 +1345,15 @@ func handleUpdateUserRole(c *gin.Context) {
 	currentUserID, _ := c.Get("user_id")
 	logUserActivity(c, currentUserID.(uint), ActionUpdate, &user, fmt.Sprintf("Changed role to '%s' for user %s %s (ID: %d)", req.Role, user.FirstName, user.LastName, user.ID))
 
+	// Programs for the new role are added; earlier assignments are kept
+	if _, err := assignOnboardingPrograms(user); err != nil {
+		log.Printf("Failed to assign onboarding programs to user %d: %v", user.ID, err)
+	}
+	// Required steps depend on the role
+	if err := refreshAssignmentsCompletion(db.Where("user_id = ?", user.ID)); err != nil {
+		log.Printf("Failed to refresh onboarding completion for user %d: %v", user.ID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"user": userToUserInfo(user)})
 }
 
@@ -1509,6 +1453,11 @@ func handleGetAuditLogs(c *gin.Context) {
 }
 
 func main() {
+	// Offline answer quality evaluation instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEvalCommand(os.Args[2:]))
+	}
+
 	// Initialize database connection
 	var err error
 	db, err = connectDB()
@@ -1523,8 +1472,13 @@ func main() {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	
-	// Initialize search engine with database data
-	_ = NewSearchEngine() // Initialize for testing, search engines are created fresh for each request
+	// Build the search index once; document changes keep it current from here on
+	if err := documentSearch.Rebuild(); err != nil {
+		log.Fatal("Failed to build search index:", err)
+	}
+
+	// Configure LLM providers in fallback order
+	llmProviders = initLLMProviders()
 	
 	r := gin.Default()
 
@@ -1547,7 +1501,7 @@ func main() {
 	config.AllowOrigins = allowedOrigins
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	config.ExposeHeaders = []string{"Content-Disposition", "Content-Type", "Content-Length"}
+	config.ExposeHeaders = []string{"Content-Disposition", "Content-Type", "Content-Length", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining"}
 	config.AllowCredentials = true
 	r.Use(cors.New(config))
 
@@ -1555,7 +1509,7 @@ func main() {
 	r.POST("/api/auth/login", handleLogin)
 	r.POST("/api/auth/register", handleRegister)
 	r.GET("/api/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
+		c.JSON(200, gin.H{"status": "healthy", "llm_providers": llmProviderStates()})
 	})
 
 	// Protected routes (authentication required)
@@ -1567,8 +1521,18 @@ func main() {
 		authenticated.PUT("/profile", handleUpdateProfile)
 		authenticated.POST("/change-password", handleChangePassword)
 
-		// Chat routes (all users can chat)
-		authenticated.POST("/chat", handleChat)
+		// Chat routes (all users can chat, within their rate limit and token quota)
+		authenticated.POST("/chat", chatLimitMiddleware(), handleChat)
+		authenticated.POST("/chat/stream", chatLimitMiddleware(), handleChatStream)
+		authenticated.GET("/usage/me", handleGetMyUsage)
+		authenticated.POST("/chat/messages/:id/feedback", handleSubmitFeedback)
+
+		// Conversation history (scoped to the current user)
+		authenticated.POST("/conversations", handleCreateConversation)
+		authenticated.GET("/conversations", handleGetConversations)
+		authenticated.GET("/conversations/:id", handleGetConversation)
+		authenticated.DELETE("/conversations/:id", handleDeleteConversation)
+		authenticated.GET("/conversations/:id/export", handleExportConversation)
 		authenticated.GET("/policies", getPolicies)
 
 		// Document viewing (all authenticated users)
@@ -1576,6 +1540,51 @@ func main() {
 		authenticated.GET("/documents/:id", getDocumentByID)
 		authenticated.GET("/documents/:id/download", downloadDocument)
 		authenticated.GET("/documents/search", searchDocuments)
+
+		// Policy acknowledgements of the current user
+		authenticated.GET("/acknowledgements/me", handleGetMyAcknowledgements)
+		authenticated.POST("/documents/:id/acknowledge", handleAcknowledgePolicy)
+
+		// Onboarding progress of the current user
+		authenticated.GET("/onboarding/me", handleGetMyOnboarding)
+		authenticated.GET("/onboarding/next", handleGetNextOnboardingStep)
+		authenticated.POST("/onboarding/steps/:id/complete", handleCompleteOnboardingStep)
+		authenticated.DELETE("/onboarding/steps/:id/complete", handleReopenOnboardingStep)
+
+		// Policy knowledge-check quizzes
+		authenticated.GET("/quizzes", handleGetQuizzes)
+		authenticated.GET("/quizzes/:id", handleGetQuiz)
+		authenticated.POST("/quizzes/:id/attempts", handleSubmitQuizAttempt)
+		authenticated.GET("/quizzes/attempts/me", handleGetMyQuizAttempts)
+
+		// Security incidents (users see their own reports)
+		authenticated.POST("/incidents", handleCreateIncident)
+		authenticated.GET("/incidents", handleGetIncidents)
+		authenticated.GET("/incidents/:id", handleGetIncident)
+	}
+
+	// Onboarding program management (HR runs onboarding alongside admins)
+	onboardingAdmin := r.Group("/api/onboarding")
+	onboardingAdmin.Use(authMiddleware(), requireRole(RoleAdmin, RoleITSecurity, RoleHR))
+	{
+		onboardingAdmin.GET("/programs", handleGetOnboardingPrograms)
+		onboardingAdmin.POST("/programs", handleCreateOnboardingProgram)
+		onboardingAdmin.PUT("/programs/:id", handleUpdateOnboardingProgram)
+		onboardingAdmin.DELETE("/programs/:id", handleDeleteOnboardingProgram)
+		onboardingAdmin.POST("/programs/:id/assign", handleAssignOnboardingProgram)
+		onboardingAdmin.GET("/progress", handleGetOnboardingProgress)
+	}
+
+	// Quiz authoring and results (HR gates onboarding on quizzes)
+	quizAdmin := r.Group("/api/quizzes")
+	quizAdmin.Use(authMiddleware(), requireRole(RoleAdmin, RoleITSecurity, RoleHR))
+	{
+		quizAdmin.POST("", handleCreateQuiz)
+		quizAdmin.POST("/draft", handleDraftQuiz)
+		quizAdmin.PUT("/:id", handleUpdateQuiz)
+		quizAdmin.DELETE("/:id", handleDeleteQuiz)
+		quizAdmin.GET("/:id/attempts", handleGetQuizAttempts)
+		quizAdmin.POST("/:id/attempts/reset", handleResetQuizAttempts)
 	}
 
 	// Admin-only routes (document and user management)
@@ -1596,24 +1605,53 @@ func main() {
 		adminOnly.PUT("/users/:id", handleUpdateUser)
 		adminOnly.PUT("/users/:id/role", handleUpdateUserRole)
 		adminOnly.DELETE("/users/:id", handleDeleteUser)
+		adminOnly.GET("/users/:id/conversations", handleGetUserConversations)
 
 		// Audit logs (admin only)
 		adminOnly.GET("/audit-logs", handleGetAuditLogs)
+
+		// LLM provider status with live health checks
+		adminOnly.GET("/llm/providers", handleGetLLMProviders)
+
+		// Versioned prompt templates
+		adminOnly.GET("/prompt-templates", handleGetPromptTemplates)
+		adminOnly.GET("/prompt-templates/:id", handleGetPromptTemplate)
+		adminOnly.POST("/prompt-templates", handleCreatePromptTemplate)
+		adminOnly.POST("/prompt-templates/:id/activate", handleActivatePromptTemplate)
+
+		// Answer feedback and quality reports
+		adminOnly.GET("/feedback", handleGetFeedback)
+		adminOnly.GET("/feedback/report", handleGetFeedbackReport)
+
+		// LLM token usage per user, day and provider
+		adminOnly.GET("/usage", handleGetUsageReport)
+
+		// Chat answer cache statistics
+		adminOnly.GET("/chat/cache", handleGetAnswerCacheStats)
+		adminOnly.DELETE("/chat/cache", handleClearAnswerCache)
+
+		// Document search index status and full rebuild
+		adminOnly.GET("/search/index", handleGetSearchIndexStats)
+		adminOnly.POST("/search/index/rebuild", handleRebuildSearchIndex)
+
+		// Who has and hasn't acknowledged each policy
+		adminOnly.GET("/acknowledgements/report", handleGetAcknowledgementReport)
+
+		// Incident handling by the security team
+		adminOnly.PUT("/incidents/:id", handleUpdateIncident)
+		adminOnly.POST("/incidents/:id/escalate", handleEscalateIncident)
 	}
 
 	log.Println("🚀 Security Chatbot Server starting on :8080...")
 	log.Println("📝 Configuration:")
 
-	if os.Getenv("OLLAMA_URL") != "" {
-		log.Printf("   ✅ Ollama URL: %s", os.Getenv("OLLAMA_URL"))
-	} else {
-		log.Println("   ⚠️  OLLAMA_URL not set")
-	}
-
-	if os.Getenv("HF_TOKEN") != "" {
-		log.Println("   ✅ Hugging Face token configured")
-	} else {
-		log.Println("   ⚠️  HF_TOKEN not set")
+	for i, provider := range llmProviders {
+		info := provider.ModelInfo()
+		if isRedacting(provider) {
+			log.Printf("   ✅ LLM provider %d: %s (%s, PII redaction on)", i+1, info.Provider, info.Model)
+		} else {
+			log.Printf("   ✅ LLM provider %d: %s (%s)", i+1, info.Provider, info.Model)
+		}
 	}
 
 	if os.Getenv("JWT_SECRET") != "" {
@@ -1625,7 +1663,7 @@ func main() {
 	log.Println("   ℹ️  Mock responses available as fallback")
 	log.Println("🔐 Authentication enabled:")
 	log.Println("   📋 Public routes: /api/auth/login, /api/auth/register, /api/health")
-	log.Println("   🔒 Protected routes: /api/chat, /api/policies, /api/documents (view)")
+	log.Println("   🔒 Protected routes: /api/chat, /api/chat/stream, /api/policies, /api/documents (view)")
 	log.Println("   👑 Admin-only routes: /api/documents (create/edit/delete)")
 
 	r.Run(":8080")
@@ -1638,41 +1676,115 @@ func handleChat(c *gin.Context) {
 		return
 	}
 
-	var response ChatResponse
+	if !guardChatRequest(c, &req) {
+		return
+	}
 
-	switch req.Type {
-	case "onboarding":
-		response = handleOnboardingWithLLM(req.Message)
-	case "policy_search":
-		response = handlePolicySearch(req.Message)
-	default:
-		response = ChatResponse{
-			Response: "I can help you with IT security onboarding or policy searches. What would you like to know?",
-			Type:     "general",
+	userID, _ := c.Get("user_id")
+	conversation, history, err := loadChatConversation(userID.(uint), req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load conversation"})
 		}
+		return
 	}
 
-	// Log chat activity with document access
+	intent := classifyChatTurn(c.Request.Context(), userID.(uint), req, history)
+
+	response, answered := intentResponse(c, currentUser(c), conversation.ID, intent.Intent, req.Message, history)
+	if !answered {
+		response = handleOnboardingWithLLM(c, req.Message, history)
+	}
+	response.Intent = intent.Intent
+	response.IntentConfidence = intent.Confidence
+
+	// Only keep citations that point at passages the model was actually given
+	response.Citations = validateCitations(response.Citations, response.Sources)
+
+	response.ConversationID = conversation.ID
+	if message, err := saveChatExchange(conversation, req, response); err != nil {
+		log.Printf("Failed to save chat messages for conversation %d: %v", conversation.ID, err)
+	} else {
+		response.MessageID = message.ID
+	}
+
+	logChatActivity(c, req, response, "")
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Log chat activity with document access
+func logChatActivity(c *gin.Context, req ChatRequest, response ChatResponse, note string) {
 	userID, _ := c.Get("user_id")
 	if len(response.PolicyFiles) > 0 {
 		var docNames []string
 		for _, doc := range response.PolicyFiles {
 			docNames = append(docNames, doc.Name)
 		}
-		logSystemActivity(c, userID.(uint), ActionView, fmt.Sprintf("Chat search '%s' returned %d documents: %s", req.Message, len(response.PolicyFiles), strings.Join(docNames, ", ")))
+		logSystemActivity(c, userID.(uint), ActionView, fmt.Sprintf("Chat search '%s' returned %d documents: %s%s", req.Message, len(response.PolicyFiles), strings.Join(docNames, ", "), note))
 	} else {
-		logSystemActivity(c, userID.(uint), ActionView, fmt.Sprintf("Chat search '%s' (type: %s) - no documents returned", req.Message, req.Type))
+		logSystemActivity(c, userID.(uint), ActionView, fmt.Sprintf("Chat search '%s' (intent: %s) - no documents returned%s", req.Message, response.Intent, note))
 	}
+}
 
-	c.JSON(http.StatusOK, response)
+func handleOnboardingWithLLM(c *gin.Context, message string, history []ChatMessage) ChatResponse {
+	response, grounded := answerFromPolicies(c.Request.Context(), currentUser(c), message, history)
+	logGuardrailFindings(c, grounded.Findings)
+	return response
 }
 
-func handleOnboardingWithLLM(message string) ChatResponse {
-	llmResponse := callLLM(message)
+// Answer a message from the retrieved policy passages, reusing a cached answer
+// when the question can be shared
+func answerFromPolicies(ctx context.Context, user User, message string, history []ChatMessage) (ChatResponse, groundedChat) {
+	grounded := prepareGroundedChat(user, message, history)
 
-	// Use enhanced search engine to find relevant documents from database
-	searchEngine := NewSearchEngine()
-	matches := searchEngine.Search(message, 5) // Limit to top 5 for onboarding
+	cacheKey, cacheable := chatCacheKey(user, message, history, grounded)
+	llmResponse, cached := (*LLMResponse)(nil), false
+	if cacheable {
+		llmResponse, cached = cachedChatAnswer(cacheKey)
+	}
+	if !cached {
+		llmResponse = callLLM(ctx, grounded.Request)
+
+		if user.ID != 0 { // Evaluation runs have no user to charge
+			recordLLMUsage(user.ID, grounded.Request, llmResponse)
+		}
+		if cacheable {
+			storeChatAnswer(cacheKey, user, llmResponse)
+		}
+	}
+
+	return ChatResponse{
+		Response:       llmResponse.Text,
+		Type:           "onboarding",
+		Provider:       llmResponse.Provider,
+		Model:          llmResponse.Model,
+		Cached:         cached,
+		PromptTemplate: grounded.Template,
+		PolicyFiles:    grounded.PolicyFiles,
+		Sources:        passagesToSources(grounded.Passages),
+		Citations:      buildCitations(llmResponse.Text, grounded.Passages),
+	}, grounded
+}
+
+// Retrieved context and LLM request for a chat turn
+type groundedChat struct {
+	PolicyFiles []PolicyFile
+	Passages    []RetrievedPassage
+	Request     LLMRequest
+	Template    *PromptTemplateRef
+	Findings    []GuardrailFinding // Injection patterns found in the retrieved passages
+}
+
+// Find the documents and passages for a question and render the active prompt template
+func prepareGroundedChat(user User, message string, history []ChatMessage) groundedChat {
+	query := retrievalQuery(message, history)
+
+	// Use enhanced search engine to find relevant documents
+	searchEngine := getSearchEngine()
+	matches := searchEngine.Search(query, 5) // Limit to top 5 for onboarding
 	
 	var matchedPolicies []PolicyFile
 	for _, match := range matches {
@@ -1680,42 +1792,39 @@ func handleOnboardingWithLLM(message string) ChatResponse {
 		matchedPolicies = append(matchedPolicies, match.Document)
 	}
 
-	return ChatResponse{
-		Response:    llmResponse,
-		Type:        "onboarding",
-		PolicyFiles: matchedPolicies,
-	}
-}
+	// Ground the LLM in the most relevant policy passages
+	passages := retrievePassages(searchEngine, query, loadRAGConfig())
 
-func handleOnboarding(message string) ChatResponse {
-	// Simulate AI response for onboarding
-	onboardingTopics := map[string]string{
-		"password": "Let me help you understand our password policy. Passwords must be at least 12 characters long, include uppercase, lowercase, numbers, and special characters. They must be changed every 90 days. Would you like me to show you the complete password policy?",
-		"vpn":      "For secure remote access, you'll need to use our company VPN. Here's what you need to know about connecting securely from remote locations...",
-		"email":    "Email security is crucial. Always verify sender identity, be cautious of links and attachments, and report suspicious emails to the security team immediately.",
-		"data":     "Data protection is everyone's responsibility. All data must be classified and handled according to our data classification policy. Let me explain the different classification levels...",
-	}
+	// Uploaded documents are untrusted: keep injected instructions out of the prompt
+	passages, promptPassages, findings := guardPassages(passages, loadGuardrailPolicy().Context)
 
-	message = strings.ToLower(message)
+	template := activePromptTemplate(ChatPromptTemplateName)
+	vars := userPromptVariables(user, message)
+	vars.Context = formatPassages(promptPassages)
+	vars.History = formatHistory(history)
+	request, template := buildLLMRequest(template, vars)
+	request.Passages = promptPassages
 
-	for keyword, resp := range onboardingTopics {
-		if strings.Contains(message, keyword) {
-			return ChatResponse{
-				Response: resp,
-				Type:     "onboarding",
-			}
-		}
+	return groundedChat{
+		PolicyFiles: matchedPolicies,
+		Passages:    passages,
+		Request:     request,
+		Template:    &PromptTemplateRef{ID: template.ID, Name: template.Name, Version: template.Version},
+		Findings:    findings,
 	}
+}
 
-	return ChatResponse{
-		Response: "Welcome to IT Security onboarding! I can help you with topics like passwords, VPN access, email security, and data protection. What would you like to learn about?",
-		Type:     "onboarding",
+// Get the authenticated user set by authMiddleware
+func currentUser(c *gin.Context) User {
+	if user, exists := c.Get("user"); exists {
+		return user.(User)
 	}
+	return User{}
 }
 
 func handlePolicySearch(query string) ChatResponse {
-	// Use enhanced search engine with database data
-	searchEngine := NewSearchEngine()
+	// Use enhanced search engine over the live document index
+	searchEngine := getSearchEngine()
 	matches := searchEngine.Search(query, 10)
 	
 	var matchedPolicies []PolicyFile
@@ -1956,6 +2065,8 @@ func createDocument(c *gin.Context) {
 		CreatedBy:    req.CreatedBy,
 		FilePath:     req.FilePath,
 		IsActive:     true,
+		Version:      1,
+		RequiresAcknowledgement: req.RequiresAcknowledgement,
 	}
 
 	// Save to database
@@ -1968,9 +2079,8 @@ func createDocument(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	logDocumentActivity(c, userID.(uint), ActionCreate, &newDoc, fmt.Sprintf("Created %s document: %s", newDoc.DocumentType, newDoc.Name))
 
-	// Update search engine with fresh database data
-	searchEngine := NewSearchEngine()
-	_ = searchEngine // Update global reference if needed
+	// Make the new document searchable
+	documentSearch.IndexDocument(newDoc)
 
 	c.JSON(http.StatusCreated, newDoc)
 }
@@ -2006,8 +2116,10 @@ func updateDocument(c *gin.Context) {
 	if req.Name != "" {
 		updates["name"] = req.Name
 	}
-	if req.Content != "" {
+	if req.Content != "" && req.Content != document.Content {
 		updates["content"] = req.Content
+		// A new version must be acknowledged again
+		updates["version"] = gorm.Expr("version + 1") // In the database, so concurrent edits each count
 	}
 	if req.Description != "" {
 		updates["description"] = req.Description
@@ -2031,6 +2143,9 @@ func updateDocument(c *gin.Context) {
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if req.RequiresAcknowledgement != nil {
+		updates["requires_acknowledgement"] = *req.RequiresAcknowledgement
+	}
 
 	// Update in database
 	if err := db.Model(&document).Updates(updates).Error; err != nil {
@@ -2048,9 +2163,11 @@ func updateDocument(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	logDocumentActivity(c, userID.(uint), ActionUpdate, &document, fmt.Sprintf("Updated %s document: %s", document.DocumentType, document.Name))
 
-	// Update search engine with fresh database data
-	searchEngine := NewSearchEngine()
-	_ = searchEngine // Update global reference if needed
+	// Answers citing the old text are stale
+	chatAnswerCache.InvalidateDocument(document.ID)
+
+	// Reindex the new text; deactivated documents leave the index
+	documentSearch.IndexDocument(document)
 
 	c.JSON(http.StatusOK, document)
 }
@@ -2084,10 +2201,12 @@ func deleteDocument(c *gin.Context) {
 	// Log document deletion
 	userID, _ := c.Get("user_id")
 	logDocumentActivity(c, userID.(uint), ActionDelete, &document, fmt.Sprintf("Deleted %s document: %s", document.DocumentType, document.Name))
+
+	// Answers citing a deleted document must not be served again
+	chatAnswerCache.InvalidateDocument(document.ID)
 	
-	// Update search engine with fresh database data
-	searchEngine := NewSearchEngine()
-	_ = searchEngine // Update global reference if needed
+	// Deleted documents no longer appear in search results
+	documentSearch.RemoveDocument(document.ID)
 	
 	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
 }
@@ -2103,23 +2222,33 @@ func searchDocuments(c *gin.Context) {
 		return
 	}
 
-	// Use enhanced search engine with fresh database data
-	searchEngine := NewSearchEngine()
-	matches := searchEngine.Search(query, 20) // Allow more results for dashboard
-	
-	var filteredDocuments []PolicyFile
-	for _, match := range matches {
-		doc := match.Document
-		
-		// Apply type and category filters
-		if documentType != "" && doc.DocumentType != documentType {
-			continue
-		}
-		if category != "" && !strings.EqualFold(doc.Category, category) {
-			continue
+	// Structured query: boolean operators, field scopes, wildcards and date filters
+	node, err := parseStructuredQuery(query)
+	if err != nil {
+		response := gin.H{"error": err.Error()}
+		var queryErr *searchQueryError
+		if errors.As(err, &queryErr) {
+			response["position"] = queryErr.Position
 		}
-		
-		filteredDocuments = append(filteredDocuments, doc)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// Type and category parameters narrow the query before ranking
+	filters := []queryNode{node}
+	if documentType != "" {
+		filters = append(filters, &typeNode{documentType: documentType})
+	}
+	if category != "" {
+		filters = append(filters, &categoryNode{category: category})
+	}
+
+	// Use enhanced search engine over the live document index
+	matches := getSearchEngine().Query(newAndNode(filters), 20) // Allow more results for dashboard
+
+	filteredDocuments := make([]PolicyFile, 0, len(matches))
+	for _, match := range matches {
+		filteredDocuments = append(filteredDocuments, match.Document)
 	}
 
 	// Log document search activity
@@ -2137,7 +2266,7 @@ func searchDocuments(c *gin.Context) {
 		"documents": filteredDocuments,
 		"total":     len(filteredDocuments),
 		"query":     c.Query("q"),
-		"matches":   matches[:minInt(len(matches), len(filteredDocuments))], // Include match details
+		"matches":   matches, // Include match details
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -2239,19 +2368,9 @@ func tokenize(text string) []string {
 	
 	words := strings.Fields(strings.ToLower(text))
 	
-	// Remove common stop words
-	stopWords := map[string]bool{
-		"the": true, "a": true, "an": true, "and": true, "or": true,
-		"but": true, "in": true, "on": true, "at": true, "to": true,
-		"for": true, "of": true, "with": true, "by": true, "is": true,
-		"are": true, "was": true, "were": true, "be": true, "been": true,
-		"have": true, "has": true, "had": true, "do": true, "does": true,
-		"did": true, "will": true, "would": true, "could": true, "should": true,
-	}
-	
 	var filtered []string
 	for _, word := range words {
-		if !stopWords[word] && len(word) > 1 {
+		if isSearchableWord(word) {
 			filtered = append(filtered, word)
 		}
 	}
@@ -2259,6 +2378,21 @@ func tokenize(text string) []string {
 	return filtered
 }
 
+// Common stop words left out of the search index
+var stopWords = map[string]bool{
+	"the": true, "a": true, "an": true, "and": true, "or": true,
+	"but": true, "in": true, "on": true, "at": true, "to": true,
+	"for": true, "of": true, "with": true, "by": true, "is": true,
+	"are": true, "was": true, "were": true, "be": true, "been": true,
+	"have": true, "has": true, "had": true, "do": true, "does": true,
+	"did": true, "will": true, "would": true, "could": true, "should": true,
+}
+
+// Whether a lowercased word is indexed: stop words and single characters are not
+func isSearchableWord(word string) bool {
+	return !stopWords[word] && len(word) > 1
+}
+
 func normalizeWord(word string) string {
 	// Convert to lowercase and remove diacritics if needed
 	word = strings.ToLower(word)
@@ -2327,181 +2461,3 @@ func minInt(a, b int) int {
 	}
 	return b
 }
-
-// Build full-text search index
-func (se *SearchEngine) BuildIndex() {
-	se.Index = make(map[string][]DocumentIndex)
-	
-	for _, doc := range se.Documents {
-		if !doc.IsActive {
-			continue
-		}
-		
-		// Index different fields with different weights
-		se.indexField(int(doc.ID), "name", doc.Name, 3.0)
-		se.indexField(int(doc.ID), "description", doc.Description, 2.0)
-		se.indexField(int(doc.ID), "content", doc.Content, 1.0)
-		se.indexField(int(doc.ID), "category", doc.Category, 2.5)
-		se.indexField(int(doc.ID), "tags", strings.Join(doc.TagsArray, " "), 2.0)
-	}
-}
-
-func (se *SearchEngine) indexField(docID int, field, text string, weight float64) {
-	words := tokenize(text)
-	
-	for pos, word := range words {
-		if len(word) < 2 { // Skip very short words
-			continue
-		}
-		
-		word = normalizeWord(word)
-		
-		// Find existing index entry
-		found := false
-		for i := range se.Index[word] {
-			if se.Index[word][i].DocumentID == docID && se.Index[word][i].Field == field {
-				se.Index[word][i].Frequency++
-				se.Index[word][i].Positions = append(se.Index[word][i].Positions, pos)
-				found = true
-				break
-			}
-		}
-		
-		if !found {
-			se.Index[word] = append(se.Index[word], DocumentIndex{
-				DocumentID: docID,
-				Field:      field,
-				Frequency:  1,
-				Positions:  []int{pos},
-			})
-		}
-	}
-}
-
-// Enhanced search with relevance scoring
-func (se *SearchEngine) Search(query string, limit int) []DocumentMatch {
-	if limit == 0 {
-		limit = 10
-	}
-	
-	queryWords := tokenize(query)
-	if len(queryWords) == 0 {
-		return []DocumentMatch{}
-	}
-	
-	// Calculate document scores
-	docScores := make(map[int]float64)
-	docMatches := make(map[int][]Match)
-	
-	for _, queryWord := range queryWords {
-		queryWord = normalizeWord(queryWord)
-		
-		// Try exact match first
-		matches := se.findMatches(queryWord)
-		
-		// If no exact matches, try fuzzy matching
-		if len(matches) == 0 {
-			fuzzyMatches := se.findFuzzyMatches(queryWord, 2) // max 2 edits
-			matches = append(matches, fuzzyMatches...)
-		}
-		
-		// Calculate TF-IDF scores
-		idf := se.calculateIDF(queryWord)
-		
-		for _, match := range matches {
-			tf := float64(match.Frequency)
-			fieldWeight := se.getFieldWeight(match.Field)
-			score := tf * idf * fieldWeight
-			
-			docScores[match.DocumentID] += score
-			
-			docMatches[match.DocumentID] = append(docMatches[match.DocumentID], Match{
-				Field: match.Field,
-				Text:  queryWord,
-				Score: score,
-			})
-		}
-	}
-	
-	// Convert to sorted results
-	var results []DocumentMatch
-	for docID, score := range docScores {
-		doc := se.getDocumentByID(uint(docID))
-		if doc != nil {
-			results = append(results, DocumentMatch{
-				Document: *doc,
-				Score:    score,
-				Matches:  docMatches[docID],
-			})
-		}
-	}
-	
-	// Sort by relevance score (descending)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
-	
-	// Apply limit
-	if len(results) > limit {
-		results = results[:limit]
-	}
-	
-	return results
-}
-
-func (se *SearchEngine) findMatches(word string) []DocumentIndex {
-	return se.Index[word]
-}
-
-func (se *SearchEngine) findFuzzyMatches(word string, maxDistance int) []DocumentIndex {
-	var matches []DocumentIndex
-	
-	for indexWord, docIndices := range se.Index {
-		if levenshteinDistance(word, indexWord) <= maxDistance {
-			matches = append(matches, docIndices...)
-		}
-	}
-	
-	return matches
-}
-
-func (se *SearchEngine) calculateIDF(word string) float64 {
-	totalDocs := len(se.Documents)
-	docsWithWord := len(se.Index[word])
-	
-	if docsWithWord == 0 {
-		return 0
-	}
-	
-	return math.Log(float64(totalDocs) / float64(docsWithWord))
-}
-
-func (se *SearchEngine) getFieldWeight(field string) float64 {
-	weights := map[string]float64{
-		"name":        3.0,
-		"description": 2.0,
-		"category":    2.5,
-		"tags":        2.0,
-		"content":     1.0,
-	}
-	
-	if weight, exists := weights[field]; exists {
-		return weight
-	}
-	return 1.0
-}
-
-func (se *SearchEngine) getDocumentByID(id uint) *PolicyFile {
-	for _, doc := range se.Documents {
-		if doc.ID == id {
-			return &doc
-		}
-	}
-	return nil
-}
-
-// Update documents in search engine
-func (se *SearchEngine) UpdateDocuments(docs []PolicyFile) {
-	se.Documents = docs
-	se.BuildIndex()
-}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Offline provider answering from the live document set without a model.
+// It picks the passage sentences that best match the question and cites them,
+// so demos, CI and AI_ENABLED=false deployments reflect the current policies.
+// The same question over the same documents always yields the same answer.
+
+type mockProvider struct {
+	maxSentences int
+}
+
+func newMockProvider() *mockProvider {
+	return &mockProvider{maxSentences: getEnvInt("MOCK_ANSWER_SENTENCES", 3)}
+}
+
+func (p *mockProvider) Name() string { return ProviderMock }
+
+func (p *mockProvider) ModelInfo() LLMModelInfo {
+	return LLMModelInfo{Provider: ProviderMock, Model: "extractive", Streaming: false}
+}
+
+func (p *mockProvider) Health(ctx context.Context) error { return nil }
+
+func (p *mockProvider) Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	passages := req.Passages
+	if len(passages) == 0 && db != nil && strings.TrimSpace(req.Question) != "" {
+		// Requests built without retrieval still get an answer from the documents
+		passages = retrievePassages(getSearchEngine(), req.Question, loadRAGConfig())
+	}
+
+	return &LLMResponse{
+		Text:     composeExtractiveAnswer(req.Question, passages, p.maxSentences),
+		Provider: ProviderMock,
+		Model:    p.ModelInfo().Model,
+	}, nil
+}
+
+func (p *mockProvider) Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	response, _ := p.Generate(ctx, req)
+	return response, onToken(response.Text)
+}
+
+// A passage sentence considered for an extractive answer
+type extractedSentence struct {
+	passage int // Index into the passages, the citation marker minus one
+	start   int // Offset within the passage text
+	text    string
+	score   float64
+}
+
+const noExtractiveAnswer = "I couldn't find anything about that in the current policy documents. " +
+	"Try rephrasing your question, or contact the IT security team if you need help."
+
+// Answer a question with the passage sentences sharing the most terms with it,
+// each followed by the marker of its passage. Sentences are scored by term
+// coverage with a small bonus for higher-ranked passages; ties keep passage order.
+func composeExtractiveAnswer(question string, passages []RetrievedPassage, maxSentences int) string {
+	if len(passages) == 0 {
+		return noExtractiveAnswer
+	}
+	if maxSentences < 1 {
+		maxSentences = 1
+	}
+
+	questionTerms := make(map[string]bool)
+	for term := range termSet(question) {
+		if !questionFillerWords[term] {
+			questionTerms[term] = true
+		}
+	}
+
+	var candidates []extractedSentence
+	seen := make(map[string]bool)
+	for i, passage := range passages {
+		rankBonus := 0.1 / float64(i+1)
+		for _, span := range sentenceSpans(passage.Text) {
+			text := strings.Join(strings.Fields(passage.Text[span[0]:span[1]]), " ")
+			key := strings.ToLower(text)
+			if seen[key] {
+				continue // Overlapping chunks repeat sentences
+			}
+			seen[key] = true
+
+			sentenceTerms := termSet(text)
+			hits := 0
+			for term := range questionTerms {
+				if sentenceTerms[term] {
+					hits++
+				}
+			}
+			if hits == 0 {
+				continue
+			}
+			candidates = append(candidates, extractedSentence{
+				passage: i,
+				start:   span[0],
+				text:    text,
+				score:   float64(hits)/float64(len(questionTerms)) + rankBonus,
+			})
+		}
+	}
+
+	if len(candidates) == 0 {
+		// Retrieval matched on name, tags or category: open with the best passage
+		spans := sentenceSpans(passages[0].Text)
+		if len(spans) == 0 {
+			return noExtractiveAnswer
+		}
+		text := strings.Join(strings.Fields(passages[0].Text[spans[0][0]:spans[0][1]]), " ")
+		candidates = []extractedSentence{{passage: 0, start: spans[0][0], text: text}}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > maxSentences {
+		candidates = candidates[:maxSentences]
+	}
+
+	// Read the chosen sentences grouped by document, in document order
+	documentRank := make(map[uint]int)
+	for _, sentence := range candidates {
+		id := passages[sentence.passage].DocumentID
+		if rank, exists := documentRank[id]; !exists || sentence.passage < rank {
+			documentRank[id] = sentence.passage
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := passages[candidates[i].passage], passages[candidates[j].passage]
+		if documentRank[a.DocumentID] != documentRank[b.DocumentID] {
+			return documentRank[a.DocumentID] < documentRank[b.DocumentID]
+		}
+		if a.Start+candidates[i].start != b.Start+candidates[j].start {
+			return a.Start+candidates[i].start < b.Start+candidates[j].start
+		}
+		return candidates[i].passage < candidates[j].passage
+	})
+
+	var answer strings.Builder
+	current := uint(0)
+	for i, sentence := range candidates {
+		passage := passages[sentence.passage]
+		switch {
+		case i == 0:
+			fmt.Fprintf(&answer, "According to the %s: ", passage.DocumentName)
+		case passage.DocumentID != current:
+			fmt.Fprintf(&answer, "\n\nAccording to the %s: ", passage.DocumentName)
+		default:
+			answer.WriteString(" ")
+		}
+		current = passage.DocumentID
+		fmt.Fprintf(&answer, "%s [%d]", sentence.text, sentence.passage+1)
+	}
+	return answer.String()
+}
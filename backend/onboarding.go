@@ -0,0 +1,988 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OnboardingProgram model for an ordered list of onboarding steps.
+// Programs with no roles apply to every user.
+type OnboardingProgram struct {
+	ID          uint             `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string           `json:"name" gorm:"not null;size:255;uniqueIndex"`
+	Description string           `json:"description" gorm:"type:text"`
+	RolesJSON   string           `json:"-" gorm:"column:roles;type:text"` // Store as JSON string in DB
+	Roles       []string         `json:"roles" gorm:"-"`                  // For JSON response
+	Steps       []OnboardingStep `json:"steps,omitempty" gorm:"foreignKey:ProgramID"`
+	IsActive    bool             `json:"is_active" gorm:"default:true;index"`
+	CreatedBy   string           `json:"created_by" gorm:"size:100"`
+	CreatedAt   time.Time        `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time        `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OnboardingStep model for one task in a program, optionally backed by a document.
+// Steps with no required roles are required for everyone; otherwise they are
+// optional for users in other roles. Steps gated by a quiz complete when it is passed.
+type OnboardingStep struct {
+	ID                uint        `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProgramID         uint        `json:"program_id" gorm:"not null;index"`
+	Position          int         `json:"position" gorm:"not null"`
+	Title             string      `json:"title" gorm:"not null;size:255"`
+	Description       string      `json:"description" gorm:"type:text"`
+	DocumentID        *uint       `json:"document_id,omitempty" gorm:"index"`
+	Document          *PolicyFile `json:"document,omitempty" gorm:"foreignKey:DocumentID"`
+	QuizID            *uint       `json:"quiz_id,omitempty" gorm:"index"`
+	DueOffsetDays     int         `json:"due_offset_days"`                          // Days after the hire date
+	RequiredRolesJSON string      `json:"-" gorm:"column:required_roles;type:text"` // Store as JSON string in DB
+	RequiredRoles     []string    `json:"required_roles" gorm:"-"`                  // For JSON response
+	CreatedAt         time.Time   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OnboardingAssignment model linking a user to a program
+type OnboardingAssignment struct {
+	ID          uint              `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      uint              `json:"user_id" gorm:"not null;uniqueIndex:idx_onboarding_user_program"`
+	User        User              `json:"-" gorm:"foreignKey:UserID"`
+	ProgramID   uint              `json:"program_id" gorm:"not null;uniqueIndex:idx_onboarding_user_program"`
+	Program     OnboardingProgram `json:"-" gorm:"foreignKey:ProgramID"`
+	HireDate    time.Time         `json:"hire_date" gorm:"not null"` // Step due dates are counted from here
+	AssignedAt  time.Time         `json:"assigned_at" gorm:"autoCreateTime"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"` // Set once every required step is done
+}
+
+// OnboardingProgress model recording a completed step
+type OnboardingProgress struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	AssignmentID uint      `json:"assignment_id" gorm:"not null;uniqueIndex:idx_onboarding_progress_step"`
+	StepID       uint      `json:"step_id" gorm:"not null;uniqueIndex:idx_onboarding_progress_step"`
+	CompletedAt  time.Time `json:"completed_at" gorm:"not null"`
+}
+
+// Request structures for onboarding program management
+type OnboardingStepRequest struct {
+	ID            uint     `json:"id"` // Existing step to keep when updating a program
+	Title         string   `json:"title" binding:"required"`
+	Description   string   `json:"description"`
+	DocumentID    *uint    `json:"document_id"`
+	QuizID        *uint    `json:"quiz_id"`
+	DueOffsetDays int      `json:"due_offset_days"`
+	RequiredRoles []string `json:"required_roles"`
+}
+
+type OnboardingProgramRequest struct {
+	Name        string                  `json:"name" binding:"required"`
+	Description string                  `json:"description"`
+	Roles       []string                `json:"roles"`
+	IsActive    *bool                   `json:"is_active"`
+	Steps       []OnboardingStepRequest `json:"steps" binding:"required"`
+}
+
+type AssignOnboardingRequest struct {
+	UserIDs     []uint `json:"user_ids"`
+	AllMatching bool   `json:"all_matching"` // Assign every active user whose role the program applies to
+	HireDate    string `json:"hire_date"`    // YYYY-MM-DD, defaults to each user's registration date
+}
+
+// OnboardingStepStatus is a step with its due date and completion for one user
+type OnboardingStepStatus struct {
+	OnboardingStep
+	Required    bool       `json:"required"`
+	DueDate     time.Time  `json:"due_date"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Overdue     bool       `json:"overdue"` // Required, open and past its due date
+}
+
+// OnboardingStatus is a user's progress through one program
+type OnboardingStatus struct {
+	AssignmentID      uint                   `json:"assignment_id"`
+	ProgramID         uint                   `json:"program_id"`
+	ProgramName       string                 `json:"program_name"`
+	Description       string                 `json:"description,omitempty"`
+	HireDate          time.Time              `json:"hire_date"`
+	AssignedAt        time.Time              `json:"assigned_at"`
+	CompletedAt       *time.Time             `json:"completed_at,omitempty"`
+	Steps             []OnboardingStepStatus `json:"steps"`
+	RequiredSteps     int                    `json:"required_steps"`
+	CompletedRequired int                    `json:"completed_required"`
+	CompletedSteps    int                    `json:"completed_steps"`
+	OverdueSteps      int                    `json:"overdue_steps"`
+	Progress          float64                `json:"progress"` // Share of required steps done, 0-1
+	NextStep          *OnboardingStepStatus  `json:"next_step,omitempty"`
+}
+
+// Roles accepted in programs and steps
+var validUserRoles = map[string]bool{
+	RoleUser:       true,
+	RoleAdmin:      true,
+	RoleHR:         true,
+	RoleITSecurity: true,
+}
+
+// Helper methods for OnboardingProgram and OnboardingStep
+func (p *OnboardingProgram) BeforeSave(tx *gorm.DB) error {
+	rolesJSON, err := marshalRoles(p.Roles)
+	p.RolesJSON = rolesJSON
+	return err
+}
+
+func (p *OnboardingProgram) AfterFind(tx *gorm.DB) error {
+	p.Roles = unmarshalRoles(p.RolesJSON)
+	return nil
+}
+
+func (s *OnboardingStep) BeforeSave(tx *gorm.DB) error {
+	rolesJSON, err := marshalRoles(s.RequiredRoles)
+	s.RequiredRolesJSON = rolesJSON
+	return err
+}
+
+func (s *OnboardingStep) AfterFind(tx *gorm.DB) error {
+	s.RequiredRoles = unmarshalRoles(s.RequiredRolesJSON)
+	return nil
+}
+
+func marshalRoles(roles []string) (string, error) {
+	if len(roles) == 0 {
+		return "", nil
+	}
+	rolesJSON, err := json.Marshal(roles)
+	return string(rolesJSON), err
+}
+
+func unmarshalRoles(rolesJSON string) []string {
+	roles := []string{}
+	if rolesJSON != "" {
+		if err := json.Unmarshal([]byte(rolesJSON), &roles); err != nil {
+			return []string{}
+		}
+	}
+	return roles
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a program is assigned to users with a role
+func (p OnboardingProgram) appliesTo(role string) bool {
+	return len(p.Roles) == 0 || containsRole(p.Roles, role)
+}
+
+// Whether a step must be completed by users with a role
+func (s OnboardingStep) requiredFor(role string) bool {
+	return len(s.RequiredRoles) == 0 || containsRole(s.RequiredRoles, role)
+}
+
+// Assign a program to a user unless already assigned. The hire date defaults to registration.
+func assignOnboardingProgram(user User, program OnboardingProgram, hireDate *time.Time) (bool, error) {
+	assignment := OnboardingAssignment{UserID: user.ID, ProgramID: program.ID, HireDate: user.CreatedAt}
+	if hireDate != nil {
+		assignment.HireDate = *hireDate
+	}
+	if assignment.HireDate.IsZero() {
+		assignment.HireDate = time.Now()
+	}
+
+	result := db.Where("user_id = ? AND program_id = ?", user.ID, program.ID).FirstOrCreate(&assignment)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Assign every active program that applies to the user's role, e.g. on registration
+// or after a role change. Returns the number of new assignments.
+func assignOnboardingPrograms(user User) (int, error) {
+	var programs []OnboardingProgram
+	if err := db.Where("is_active = ?", true).Find(&programs).Error; err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+	for _, program := range programs {
+		if !program.appliesTo(user.Role) {
+			continue
+		}
+		created, err := assignOnboardingProgram(user, program, nil)
+		if err != nil {
+			return assigned, err
+		}
+		if created {
+			assigned++
+		}
+	}
+	return assigned, nil
+}
+
+// Progress of one assignment. The program must be loaded with its steps in order.
+func onboardingStatus(assignment OnboardingAssignment, role string, completed map[uint]time.Time) OnboardingStatus {
+	status := OnboardingStatus{
+		AssignmentID: assignment.ID,
+		ProgramID:    assignment.ProgramID,
+		ProgramName:  assignment.Program.Name,
+		Description:  assignment.Program.Description,
+		HireDate:     assignment.HireDate,
+		AssignedAt:   assignment.AssignedAt,
+		CompletedAt:  assignment.CompletedAt,
+		Steps:        []OnboardingStepStatus{},
+	}
+
+	now := time.Now()
+	for _, step := range assignment.Program.Steps {
+		stepStatus := OnboardingStepStatus{
+			OnboardingStep: step,
+			Required:       step.requiredFor(role),
+			DueDate:        assignment.HireDate.AddDate(0, 0, step.DueOffsetDays),
+		}
+		if completedAt, done := completed[step.ID]; done {
+			stepStatus.CompletedAt = &completedAt
+			status.CompletedSteps++
+		} else if stepStatus.Required && now.After(stepStatus.DueDate) {
+			stepStatus.Overdue = true
+			status.OverdueSteps++
+		}
+		if stepStatus.Required {
+			status.RequiredSteps++
+			if stepStatus.CompletedAt != nil {
+				status.CompletedRequired++
+			}
+		}
+		status.Steps = append(status.Steps, stepStatus)
+	}
+
+	if status.RequiredSteps > 0 {
+		status.Progress = float64(status.CompletedRequired) / float64(status.RequiredSteps)
+	} else {
+		status.Progress = 1
+	}
+	status.NextStep = nextOnboardingStep([]OnboardingStatus{status})
+	return status
+}
+
+// Next step across programs: the open required step due soonest, then open optional steps
+func nextOnboardingStep(statuses []OnboardingStatus) *OnboardingStepStatus {
+	var open []OnboardingStepStatus
+	for _, status := range statuses {
+		for _, step := range status.Steps {
+			if step.CompletedAt == nil {
+				open = append(open, step)
+			}
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(open, func(i, j int) bool {
+		if open[i].Required != open[j].Required {
+			return open[i].Required
+		}
+		if !open[i].DueDate.Equal(open[j].DueDate) {
+			return open[i].DueDate.Before(open[j].DueDate)
+		}
+		return open[i].Position < open[j].Position
+	})
+	return &open[0]
+}
+
+// Load assignments with their programs and steps in order
+func loadOnboardingAssignments(query *gorm.DB) ([]OnboardingAssignment, error) {
+	var assignments []OnboardingAssignment
+	err := query.
+		Preload("Program").
+		Preload("Program.Steps", func(tx *gorm.DB) *gorm.DB { return tx.Order("position ASC") }).
+		Preload("Program.Steps.Document", func(tx *gorm.DB) *gorm.DB {
+			return tx.Select("id", "name", "description", "category", "document_type", "is_active")
+		}).
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// Completed steps per assignment
+func onboardingCompletions(assignmentIDs []uint) (map[uint]map[uint]time.Time, error) {
+	completions := make(map[uint]map[uint]time.Time)
+	if len(assignmentIDs) == 0 {
+		return completions, nil
+	}
+
+	var progress []OnboardingProgress
+	if err := db.Where("assignment_id IN ?", assignmentIDs).Find(&progress).Error; err != nil {
+		return nil, err
+	}
+	for _, entry := range progress {
+		if completions[entry.AssignmentID] == nil {
+			completions[entry.AssignmentID] = make(map[uint]time.Time)
+		}
+		completions[entry.AssignmentID][entry.StepID] = entry.CompletedAt
+	}
+	return completions, nil
+}
+
+// Progress of a user through all of their active programs
+func userOnboardingStatus(user User) ([]OnboardingStatus, error) {
+	assignments, err := loadOnboardingAssignments(
+		db.Joins("JOIN onboarding_programs ON onboarding_programs.id = onboarding_assignments.program_id").
+			Where("onboarding_assignments.user_id = ? AND onboarding_programs.is_active = ?", user.ID, true).
+			Order("onboarding_assignments.assigned_at ASC"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(assignments))
+	for _, assignment := range assignments {
+		ids = append(ids, assignment.ID)
+	}
+	completions, err := onboardingCompletions(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]OnboardingStatus, 0, len(assignments))
+	for _, assignment := range assignments {
+		statuses = append(statuses, onboardingStatus(assignment, user.Role, completions[assignment.ID]))
+	}
+	return statuses, nil
+}
+
+// Questions about the user's own onboarding progress, answered from the assignments.
+// Phrases like "next step" on their own also come up in policy questions, so they
+// must be tied to the user or to onboarding.
+var onboardingProgressPattern = regexp.MustCompile(`(?i)\b(?:my next (?:onboarding )?(?:step|task)|what(?:'s| is) next for me|what should i do (?:next|first) (?:for|in) (?:my )?onboarding|my onboarding(?: (?:progress|checklist|steps?|tasks?))?|my (?:onboarding )?checklist|(?:onboarding (?:steps?|tasks?)|do i have (?:any )?(?:steps?|tasks?)) (?:left|remaining)|have i (?:finished|completed) (?:my )?onboarding)\b`)
+
+// Topics a progress question may mention that need an answer from the policies,
+// as in "what is my next step after reporting an incident?"
+var onboardingOtherTopicPattern = regexp.MustCompile(`(?i)\b(?:incidents?|breach(?:es)?|hacked|phished|compromised|ransomware|malware|stolen|lost (?:my|a|the))\b`)
+
+// Chat answer for "what's my next step"; false when the message is not about
+// progress or also asks about another topic
+func onboardingChatResponse(user User, message string) (ChatResponse, bool) {
+	if !onboardingProgressPattern.MatchString(message) || onboardingOtherTopicPattern.MatchString(message) {
+		return ChatResponse{}, false
+	}
+
+	statuses, err := userOnboardingStatus(user)
+	if err != nil {
+		log.Printf("Failed to load onboarding progress for user %d: %v", user.ID, err)
+		return ChatResponse{}, false
+	}
+	if len(statuses) == 0 {
+		return ChatResponse{
+			Response: "You have no onboarding program assigned. Ask an administrator if you think this is a mistake.",
+			Type:     "onboarding",
+		}, true
+	}
+
+	var summary []string
+	for _, status := range statuses {
+		summary = append(summary, fmt.Sprintf("%s: %d of %d required steps done", status.ProgramName, status.CompletedRequired, status.RequiredSteps))
+	}
+
+	next := nextOnboardingStep(statuses)
+	if next == nil {
+		return ChatResponse{
+			Response: "You have completed all of your onboarding steps. Well done!\n" + strings.Join(summary, "\n"),
+			Type:     "onboarding",
+		}, true
+	}
+
+	var text strings.Builder
+	text.WriteString(strings.Join(summary, "\n"))
+	fmt.Fprintf(&text, "\n\nYour next step is \"%s\", due %s", next.Title, next.DueDate.Format("2006-01-02"))
+	if next.Overdue {
+		text.WriteString(" (overdue)")
+	}
+	text.WriteString(".")
+	if next.Description != "" {
+		text.WriteString(" " + next.Description)
+	}
+
+	response := ChatResponse{Type: "onboarding"}
+	if next.Document != nil {
+		fmt.Fprintf(&text, " Start by reading \"%s\".", next.Document.Name)
+		var document PolicyFile
+		if err := db.First(&document, next.Document.ID).Error; err == nil {
+			response.PolicyFiles = []PolicyFile{document}
+		}
+	}
+	response.Response = text.String()
+	return response, true
+}
+
+// Seed a default program from the sample onboarding documents if none exists yet
+func seedOnboardingPrograms() error {
+	var count int64
+	if err := db.Model(&OnboardingProgram{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	documentID := func(name string) *uint {
+		var document PolicyFile
+		if err := db.Select("id").Where("name = ?", name).First(&document).Error; err != nil {
+			return nil
+		}
+		return &document.ID
+	}
+
+	program := OnboardingProgram{
+		Name:        "IT Security Onboarding",
+		Description: "Security essentials every new employee completes in their first week",
+		IsActive:    true,
+		CreatedBy:   "System",
+		Steps: []OnboardingStep{
+			{Position: 1, Title: "Read the security onboarding guide", DocumentID: documentID("New Employee Security Onboarding"), DueOffsetDays: 1},
+			{Position: 2, Title: "Set a compliant password", Description: "Change your initial password to one that meets the password policy.", DocumentID: documentID("Password Policy"), DueOffsetDays: 1},
+			{Position: 3, Title: "Configure the VPN", DocumentID: documentID("VPN Setup Guide"), DueOffsetDays: 3},
+			{Position: 4, Title: "Learn how to classify data", DocumentID: documentID("Data Classification Policy"), DueOffsetDays: 5},
+			{Position: 5, Title: "Know how to report an incident", DocumentID: documentID("Incident Response Policy"), DueOffsetDays: 5},
+			{Position: 6, Title: "Review remote work rules", DocumentID: documentID("Remote Work Security Policy"), DueOffsetDays: 7},
+			{Position: 7, Title: "Review the incident escalation matrix", Description: "Security staff handle L2 escalations and must know the matrix.", DocumentID: documentID("Incident Response Policy"), DueOffsetDays: 7, RequiredRoles: []string{RoleITSecurity, RoleAdmin}},
+		},
+	}
+	if err := db.Create(&program).Error; err != nil {
+		return fmt.Errorf("failed to seed onboarding program: %v", err)
+	}
+
+	log.Printf("Seeded onboarding program %q with %d steps", program.Name, len(program.Steps))
+	return nil
+}
+
+// Validate a program request and build its steps in the requested order
+func onboardingStepsFromRequest(req OnboardingProgramRequest) ([]OnboardingStep, error) {
+	for _, role := range req.Roles {
+		if !validUserRoles[role] {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+	}
+	if len(req.Steps) == 0 {
+		return nil, fmt.Errorf("a program needs at least one step")
+	}
+
+	steps := make([]OnboardingStep, 0, len(req.Steps))
+	for i, stepReq := range req.Steps {
+		if strings.TrimSpace(stepReq.Title) == "" {
+			return nil, fmt.Errorf("step %d needs a title", i+1)
+		}
+		if stepReq.DueOffsetDays < 0 {
+			return nil, fmt.Errorf("step %d has a negative due offset", i+1)
+		}
+		for _, role := range stepReq.RequiredRoles {
+			if !validUserRoles[role] {
+				return nil, fmt.Errorf("step %d has unknown role %q", i+1, role)
+			}
+		}
+		if stepReq.DocumentID != nil {
+			var document PolicyFile
+			if err := db.Select("id").First(&document, *stepReq.DocumentID).Error; err != nil {
+				return nil, fmt.Errorf("step %d references unknown document %d", i+1, *stepReq.DocumentID)
+			}
+		}
+		if stepReq.QuizID != nil {
+			var quiz Quiz
+			if err := db.Select("id", "is_published").Where("is_active = ?", true).First(&quiz, *stepReq.QuizID).Error; err != nil {
+				return nil, fmt.Errorf("step %d references unknown quiz %d", i+1, *stepReq.QuizID)
+			}
+			if !quiz.IsPublished {
+				return nil, fmt.Errorf("step %d references quiz %d, which is not published", i+1, *stepReq.QuizID)
+			}
+		}
+
+		steps = append(steps, OnboardingStep{
+			ID:            stepReq.ID,
+			Position:      i + 1,
+			Title:         strings.TrimSpace(stepReq.Title),
+			Description:   stepReq.Description,
+			DocumentID:    stepReq.DocumentID,
+			QuizID:        stepReq.QuizID,
+			DueOffsetDays: stepReq.DueOffsetDays,
+			RequiredRoles: stepReq.RequiredRoles,
+		})
+	}
+	return steps, nil
+}
+
+// Mark an assignment complete once all required steps are done, or reopen it
+func refreshAssignmentCompletion(assignment OnboardingAssignment, role string) (OnboardingStatus, error) {
+	completions, err := onboardingCompletions([]uint{assignment.ID})
+	if err != nil {
+		return OnboardingStatus{}, err
+	}
+	status := onboardingStatus(assignment, role, completions[assignment.ID])
+
+	done := status.CompletedRequired == status.RequiredSteps
+	switch {
+	case done && assignment.CompletedAt == nil:
+		now := time.Now()
+		assignment.CompletedAt = &now
+	case !done && assignment.CompletedAt != nil:
+		assignment.CompletedAt = nil
+	default:
+		return status, nil
+	}
+	if err := db.Model(&assignment).Update("completed_at", assignment.CompletedAt).Error; err != nil {
+		return status, err
+	}
+	status.CompletedAt = assignment.CompletedAt
+	return status, nil
+}
+
+// Recalculate completion for the assignments a query selects, after changes
+// that alter which steps are required: program steps or a user's role
+func refreshAssignmentsCompletion(query *gorm.DB) error {
+	assignments, err := loadOnboardingAssignments(query)
+	if err != nil {
+		return err
+	}
+
+	userIDs := make([]uint, 0, len(assignments))
+	for _, assignment := range assignments {
+		userIDs = append(userIDs, assignment.UserID)
+	}
+	var users []User
+	if len(userIDs) > 0 {
+		if err := db.Select("id", "role").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return err
+		}
+	}
+	roles := make(map[uint]string, len(users))
+	for _, user := range users {
+		roles[user.ID] = user.Role
+	}
+
+	for _, assignment := range assignments {
+		if _, err := refreshAssignmentCompletion(assignment, roles[assignment.UserID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Onboarding handlers
+
+// Get the current user's programs, step status and next step
+func handleGetMyOnboarding(c *gin.Context) {
+	user := currentUser(c)
+	statuses, err := userOnboardingStatus(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch onboarding progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"programs":  statuses,
+		"next_step": nextOnboardingStep(statuses),
+	})
+}
+
+// Get only the current user's next onboarding step
+func handleGetNextOnboardingStep(c *gin.Context) {
+	statuses, err := userOnboardingStatus(currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch onboarding progress"})
+		return
+	}
+
+	next := nextOnboardingStep(statuses)
+	c.JSON(http.StatusOK, gin.H{
+		"next_step": next,
+		"completed": len(statuses) > 0 && next == nil,
+	})
+}
+
+// Find the current user's assignment for a step
+func assignmentForStep(c *gin.Context) (OnboardingAssignment, OnboardingStep, bool) {
+	stepID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid step ID"})
+		return OnboardingAssignment{}, OnboardingStep{}, false
+	}
+
+	var step OnboardingStep
+	if err := db.First(&step, stepID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Step not found"})
+		return OnboardingAssignment{}, OnboardingStep{}, false
+	}
+
+	userID, _ := c.Get("user_id")
+	assignments, err := loadOnboardingAssignments(db.Where("user_id = ? AND program_id = ?", userID, step.ProgramID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch onboarding assignment"})
+		return OnboardingAssignment{}, OnboardingStep{}, false
+	}
+	if len(assignments) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not assigned to this onboarding program"})
+		return OnboardingAssignment{}, OnboardingStep{}, false
+	}
+	return assignments[0], step, true
+}
+
+// Mark a step complete for the current user
+func handleCompleteOnboardingStep(c *gin.Context) {
+	assignment, step, ok := assignmentForStep(c)
+	if !ok {
+		return
+	}
+
+	user := currentUser(c)
+	if step.QuizID != nil && !hasPassedQuiz(user.ID, *step.QuizID) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Pass the knowledge check quiz to complete this step",
+			"quiz_id": *step.QuizID,
+		})
+		return
+	}
+
+	progress := OnboardingProgress{AssignmentID: assignment.ID, StepID: step.ID, CompletedAt: time.Now()}
+	result := db.Where("assignment_id = ? AND step_id = ?", assignment.ID, step.ID).FirstOrCreate(&progress)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record step completion"})
+		return
+	}
+
+	status, err := refreshAssignmentCompletion(assignment, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding progress"})
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logAuditActivity(c, user.ID, ActionUpdate, ResourceOnboarding, &step.ID, step.Title,
+			fmt.Sprintf("Completed onboarding step %q of %s (%d/%d required)", step.Title, assignment.Program.Name, status.CompletedRequired, status.RequiredSteps))
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Undo a step completion for the current user
+func handleReopenOnboardingStep(c *gin.Context) {
+	assignment, step, ok := assignmentForStep(c)
+	if !ok {
+		return
+	}
+
+	result := db.Where("assignment_id = ? AND step_id = ?", assignment.ID, step.ID).Delete(&OnboardingProgress{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reopen step"})
+		return
+	}
+
+	user := currentUser(c)
+	status, err := refreshAssignmentCompletion(assignment, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding progress"})
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logAuditActivity(c, user.ID, ActionUpdate, ResourceOnboarding, &step.ID, step.Title,
+			fmt.Sprintf("Reopened onboarding step %q of %s", step.Title, assignment.Program.Name))
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Onboarding program management handlers (Admin only)
+
+func handleGetOnboardingPrograms(c *gin.Context) {
+	query := db.Preload("Steps", func(tx *gorm.DB) *gorm.DB { return tx.Order("position ASC") })
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var programs []OnboardingProgram
+	if err := query.Order("name ASC").Find(&programs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch onboarding programs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"programs": programs})
+}
+
+func handleCreateOnboardingProgram(c *gin.Context) {
+	var req OnboardingProgramRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	steps, err := onboardingStepsFromRequest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range steps {
+		steps[i].ID = 0
+	}
+
+	user := currentUser(c)
+	program := OnboardingProgram{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Roles:       req.Roles,
+		Steps:       steps,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+		CreatedBy:   user.Username,
+	}
+	if err := db.Create(&program).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to create program, the name may already be in use"})
+		return
+	}
+
+	logAuditActivity(c, user.ID, ActionCreate, ResourceOnboarding, &program.ID, program.Name,
+		fmt.Sprintf("Created onboarding program %s with %d steps", program.Name, len(program.Steps)))
+
+	c.JSON(http.StatusCreated, program)
+}
+
+// Update a program and replace its steps. Steps sent with an ID keep their
+// completions; steps left out are deleted together with their progress.
+func handleUpdateOnboardingProgram(c *gin.Context) {
+	programID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid program ID"})
+		return
+	}
+
+	var program OnboardingProgram
+	if err := db.Preload("Steps").First(&program, programID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch program"})
+		}
+		return
+	}
+
+	var req OnboardingProgramRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	steps, err := onboardingStepsFromRequest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing := make(map[uint]OnboardingStep)
+	for _, step := range program.Steps {
+		existing[step.ID] = step
+	}
+	kept := make(map[uint]bool)
+	for i := range steps {
+		if steps[i].ID != 0 {
+			original, exists := existing[steps[i].ID]
+			if !exists {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Step %d does not belong to this program", steps[i].ID)})
+				return
+			}
+			steps[i].CreatedAt = original.CreatedAt
+		}
+		steps[i].ProgramID = program.ID
+		kept[steps[i].ID] = true
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var removed []uint
+		for id := range existing {
+			if !kept[id] {
+				removed = append(removed, id)
+			}
+		}
+		if len(removed) > 0 {
+			if err := tx.Where("step_id IN ?", removed).Delete(&OnboardingProgress{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&OnboardingStep{}, removed).Error; err != nil {
+				return err
+			}
+		}
+		for i := range steps {
+			if err := tx.Save(&steps[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		program.Name = strings.TrimSpace(req.Name)
+		program.Description = req.Description
+		program.Roles = req.Roles
+		if req.IsActive != nil {
+			program.IsActive = *req.IsActive
+		}
+		program.Steps = nil
+		return tx.Save(&program).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update program"})
+		return
+	}
+	program.Steps = steps
+
+	// Added or removed required steps change who has finished the program
+	if err := refreshAssignmentsCompletion(db.Where("program_id = ?", program.ID)); err != nil {
+		log.Printf("Failed to refresh onboarding completion for program %d: %v", program.ID, err)
+	}
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionUpdate, ResourceOnboarding, &program.ID, program.Name,
+		fmt.Sprintf("Updated onboarding program %s (%d steps)", program.Name, len(steps)))
+
+	c.JSON(http.StatusOK, program)
+}
+
+// Deactivate a program (soft delete); assignments and progress are kept
+func handleDeleteOnboardingProgram(c *gin.Context) {
+	programID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid program ID"})
+		return
+	}
+
+	var program OnboardingProgram
+	if err := db.First(&program, programID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+		return
+	}
+
+	if err := db.Model(&program).Update("is_active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate program"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionDelete, ResourceOnboarding, &program.ID, program.Name,
+		fmt.Sprintf("Deactivated onboarding program %s", program.Name))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Program deactivated successfully"})
+}
+
+// Assign a program to users, e.g. existing staff when a program is introduced
+func handleAssignOnboardingProgram(c *gin.Context) {
+	programID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid program ID"})
+		return
+	}
+
+	var program OnboardingProgram
+	if err := db.First(&program, programID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+		return
+	}
+
+	var req AssignOnboardingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.UserIDs) == 0 && !req.AllMatching {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide user_ids or set all_matching"})
+		return
+	}
+
+	var hireDate *time.Time
+	if req.HireDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.HireDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hire_date must be formatted as YYYY-MM-DD"})
+			return
+		}
+		hireDate = &parsed
+	}
+
+	query := db.Where("is_active = ?", true)
+	if !req.AllMatching {
+		query = query.Where("id IN ?", req.UserIDs)
+	}
+	var users []User
+	if err := query.Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	assigned := 0
+	for _, user := range users {
+		if req.AllMatching && !program.appliesTo(user.Role) {
+			continue
+		}
+		created, err := assignOnboardingProgram(user, program, hireDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign program"})
+			return
+		}
+		if created {
+			assigned++
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionUpdate, ResourceOnboarding, &program.ID, program.Name,
+		fmt.Sprintf("Assigned onboarding program %s to %d users", program.Name, assigned))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Program assigned", "assigned": assigned})
+}
+
+// Progress of every assignment, optionally filtered by program, user or state
+// ("completed", "in_progress", "overdue")
+func handleGetOnboardingProgress(c *gin.Context) {
+	query := db.Model(&OnboardingAssignment{}).Preload("User")
+	if programID := c.Query("program_id"); programID != "" {
+		query = query.Where("program_id = ?", programID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	switch c.Query("status") {
+	case "completed":
+		query = query.Where("completed_at IS NOT NULL")
+	case "in_progress", "overdue":
+		query = query.Where("completed_at IS NULL")
+	}
+
+	assignments, err := loadOnboardingAssignments(query.Order("assigned_at DESC"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch onboarding progress"})
+		return
+	}
+
+	ids := make([]uint, 0, len(assignments))
+	for _, assignment := range assignments {
+		ids = append(ids, assignment.ID)
+	}
+	completions, err := onboardingCompletions(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch onboarding progress"})
+		return
+	}
+
+	type userProgress struct {
+		User UserInfo `json:"user"`
+		OnboardingStatus
+	}
+	progress := []userProgress{}
+	for _, assignment := range assignments {
+		status := onboardingStatus(assignment, assignment.User.Role, completions[assignment.ID])
+		if c.Query("status") == "overdue" && status.OverdueSteps == 0 {
+			continue
+		}
+		progress = append(progress, userProgress{User: userToUserInfo(assignment.User), OnboardingStatus: status})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignments": progress, "total": len(progress)})
+}
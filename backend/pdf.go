@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Minimal PDF writer for generated text reports such as conversation transcripts.
+// It lays out wrapped lines of Helvetica on A4 pages; the standard fonts need no
+// embedding, which keeps the output small and free of external dependencies.
+
+const (
+	pdfPageWidth  = 595.0 // A4 in points
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+	pdfCharWidth  = 0.52 // Average Helvetica glyph width as a share of the font size, used for wrapping
+)
+
+// PDF fonts, registered as /F1 and /F2 on every page
+const (
+	pdfFontRegular = "F1"
+	pdfFontBold    = "F2"
+)
+
+type textPDF struct {
+	title string
+	pages []*bytes.Buffer
+	y     float64 // Baseline of the next line on the current page
+}
+
+func newTextPDF(title string) *textPDF {
+	pdf := &textPDF{title: title}
+	pdf.newPage()
+	return pdf
+}
+
+func (p *textPDF) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// Write one line without wrapping, starting a new page when the current one is full
+func (p *textPDF) line(text, font string, size, indent float64) {
+	leading := size * 1.4
+	if p.y-leading < pdfMargin {
+		p.newPage()
+	}
+	p.y -= leading
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n",
+		font, size, pdfMargin+indent, p.y, pdfEscape(text))
+}
+
+// Write text wrapped to the page width, keeping its line breaks
+func (p *textPDF) paragraph(text, font string, size, indent float64) {
+	width := int((pdfPageWidth - 2*pdfMargin - indent) / (size * pdfCharWidth))
+	for _, raw := range strings.Split(text, "\n") {
+		for _, wrapped := range wrapText(raw, width) {
+			p.line(wrapped, font, size, indent)
+		}
+	}
+}
+
+func (p *textPDF) space(height float64) {
+	p.y -= height
+}
+
+// Horizontal rule across the text area
+func (p *textPDF) rule() {
+	p.space(6)
+	if p.y < pdfMargin {
+		p.newPage()
+	}
+	fmt.Fprintf(p.pages[len(p.pages)-1], "0.7 G 0.5 w %.1f %.1f m %.1f %.1f l S 0 G\n",
+		pdfMargin, p.y, pdfPageWidth-pdfMargin, p.y)
+	p.space(4)
+}
+
+// Assemble the document, adding page numbers to the footer of every page
+func (p *textPDF) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-5 are fixed; each page then takes a page object and a content stream
+	const firstPage = 6
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (Security Chatbot) /CreationDate (D:%s) >>",
+		pdfEscape(p.title), time.Now().UTC().Format("20060102150405Z")))
+
+	for i, page := range p.pages {
+		content := page.String() + fmt.Sprintf("BT /%s 8.0 Tf %.1f %.1f Td (%s) Tj ET\n",
+			pdfFontRegular, pdfMargin, pdfMargin/2, pdfEscape(fmt.Sprintf("%s - page %d of %d", p.title, i+1, len(p.pages))))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, pdfFontRegular, pdfFontBold, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// Split a line into chunks of at most width characters, breaking at spaces where possible
+func wrapText(text string, width int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	current := ""
+	for _, word := range words {
+		for len([]rune(word)) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			lines = append(lines, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+		switch {
+		case current == "":
+			current = word
+		case len([]rune(current))+1+len([]rune(word)) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	return append(lines, current)
+}
+
+// Characters outside Latin-1 that have a WinAnsi code or a close ASCII equivalent
+var pdfReplacements = map[rune]string{
+	'‘': "'", '’': "'", '“': "\"", '”': "\"",
+	'–': "-", '—': "-", '…': "...", '•': "\x95",
+	'→': "->", '←': "<-", '✅': "[x]", '❌': "[ ]", '⚠': "!",
+}
+
+// Encode text as a WinAnsi PDF string literal body
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString("    ")
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			if replacement, exists := pdfReplacements[r]; exists {
+				for i := 0; i < len(replacement); i++ {
+					if replacement[i] > 0x7f {
+						fmt.Fprintf(&b, "\\%03o", replacement[i])
+					} else {
+						b.WriteByte(replacement[i])
+					}
+				}
+			} else if r >= 0x20 {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
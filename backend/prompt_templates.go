@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PromptTemplate model for versioned, admin-managed LLM prompts.
+// Versions are immutable: editing a prompt creates a new version.
+type PromptTemplate struct {
+	ID              uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name            string    `json:"name" gorm:"not null;size:100;uniqueIndex:idx_prompt_name_version"`
+	Version         int       `json:"version" gorm:"not null;uniqueIndex:idx_prompt_name_version"`
+	SystemPrompt    string    `json:"system_prompt" gorm:"type:text"`
+	Template        string    `json:"template" gorm:"type:text;not null"`
+	Provider        string    `json:"provider,omitempty" gorm:"size:50"` // Provider the model override applies to
+	Model           string    `json:"model,omitempty" gorm:"size:100"`
+	Temperature     *float64  `json:"temperature,omitempty"`
+	MaxTokens       *int      `json:"max_tokens,omitempty"`
+	ChangeNote      string    `json:"change_note,omitempty" gorm:"type:text"`
+	IsActive        bool      `json:"is_active" gorm:"default:false;index"`
+	CreatedBy       string    `json:"created_by" gorm:"size:100"`
+	CreatedByUserID *uint     `json:"created_by_user_id,omitempty" gorm:"index"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Variables available inside prompt templates, e.g. {{.Question}}
+type PromptVariables struct {
+	UserName  string // First and last name of the employee
+	FirstName string
+	Role      string
+	Question  string
+	Context   string // Numbered policy passages, empty when nothing matched
+	History   string // Recent conversation turns, empty for a new conversation
+	Date      string
+}
+
+// Request structure for creating a prompt template version
+type CreatePromptTemplateRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	SystemPrompt string   `json:"system_prompt"`
+	Template     string   `json:"template" binding:"required"`
+	Provider     string   `json:"provider"`
+	Model        string   `json:"model"`
+	Temperature  *float64 `json:"temperature"`
+	MaxTokens    *int     `json:"max_tokens"`
+	ChangeNote   string   `json:"change_note"`
+	Activate     bool     `json:"activate"`
+}
+
+// Name of the template used by the chat pipeline
+const ChatPromptTemplateName = "chat"
+
+// Built-in chat prompt, seeded as version 1 and used when the database has none
+var defaultChatPromptTemplate = PromptTemplate{
+	Name:    ChatPromptTemplateName,
+	Version: 1,
+	SystemPrompt: "You are an IT security assistant for company onboarding. " +
+		"You help employees understand the company's security policies.",
+	Template: `{{if .Context}}Answer the question using ONLY the policy passages below. If the passages do not contain the answer, say that the policies do not cover it instead of guessing. Cite the passage backing each statement with its number in square brackets, e.g. [1].
+
+Policy passages:
+{{.Context}}
+{{else}}No company policy passages matched this question. Say that you could not find a relevant policy and do not invent company rules.
+
+{{end}}{{if .History}}Conversation so far:
+{{.History}}
+{{end}}Employee Question ({{.UserName}}, {{.Role}}): {{.Question}}
+
+Provide a helpful, professional response. Keep it concise and actionable.`,
+	ChangeNote: "Initial grounded chat prompt",
+	IsActive:   true,
+	CreatedBy:  "System",
+}
+
+// Seed the default chat prompt if no version exists yet
+func seedPromptTemplates() error {
+	var count int64
+	if err := db.Model(&PromptTemplate{}).Where("name = ?", ChatPromptTemplateName).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	template := defaultChatPromptTemplate
+	if err := db.Create(&template).Error; err != nil {
+		return fmt.Errorf("failed to seed prompt template: %v", err)
+	}
+
+	log.Printf("Seeded prompt template %s v%d", template.Name, template.Version)
+	return nil
+}
+
+// Get the active version of a prompt template, falling back to the built-in default
+func activePromptTemplate(name string) PromptTemplate {
+	if db != nil {
+		var template PromptTemplate
+		err := db.Where("name = ? AND is_active = ?", name, true).Order("version DESC").First(&template).Error
+		if err == nil {
+			return template
+		}
+		if err != gorm.ErrRecordNotFound {
+			log.Printf("Failed to load prompt template %s: %v", name, err)
+		}
+	}
+	return defaultChatPromptTemplate
+}
+
+// Render a template into the user prompt
+func renderPromptTemplate(pt PromptTemplate, vars PromptVariables) (string, error) {
+	tmpl, err := template.New(pt.Name).Option("missingkey=error").Parse(pt.Template)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, vars); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// Build the LLM request for a template, applying its generation parameters.
+// Returns the template actually used, which is the default if the given one fails to render.
+func buildLLMRequest(pt PromptTemplate, vars PromptVariables) (LLMRequest, PromptTemplate) {
+	prompt, err := renderPromptTemplate(pt, vars)
+	if err != nil {
+		// A broken template must never take the chatbot down
+		log.Printf("Failed to render prompt template %s v%d, using default: %v", pt.Name, pt.Version, err)
+		pt = defaultChatPromptTemplate
+		prompt, _ = renderPromptTemplate(pt, vars)
+	}
+
+	req := LLMRequest{
+		System:      pt.SystemPrompt,
+		Prompt:      prompt,
+		Question:    vars.Question,
+		Temperature: pt.Temperature,
+		MaxTokens:   pt.MaxTokens,
+	}
+	if pt.Provider != "" && pt.Model != "" {
+		req.ModelOverrides = map[string]string{pt.Provider: pt.Model}
+	}
+	return req, pt
+}
+
+// Format passages as numbered context for the prompt
+func formatPassages(passages []RetrievedPassage) string {
+	var context strings.Builder
+	for i, passage := range passages {
+		context.WriteString(fmt.Sprintf("[%d] %s (document %d)\n%s\n\n", i+1, passage.DocumentName, passage.DocumentID, passage.Text))
+	}
+	return context.String()
+}
+
+// Format prior conversation turns for the prompt
+func formatHistory(history []ChatMessage) string {
+	var lines strings.Builder
+	for _, message := range history {
+		speaker := "Employee"
+		if message.Role == MessageRoleAssistant {
+			speaker = "Assistant"
+		}
+		lines.WriteString(fmt.Sprintf("%s: %s\n", speaker, stripCitationMarkers(message.Content)))
+	}
+	return lines.String()
+}
+
+// Prompt variables describing the current user
+func userPromptVariables(user User, question string) PromptVariables {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Username
+	}
+	role := user.Role
+	if role == "" {
+		role = RoleUser
+	}
+
+	return PromptVariables{
+		UserName:  name,
+		FirstName: user.FirstName,
+		Role:      role,
+		Question:  question,
+		Date:      time.Now().Format("2006-01-02"),
+	}
+}
+
+// Check that a template parses and renders with sample variables
+func validatePromptTemplate(pt PromptTemplate) error {
+	_, err := renderPromptTemplate(pt, PromptVariables{
+		UserName:  "Jane Doe",
+		FirstName: "Jane",
+		Role:      RoleUser,
+		Question:  "How long must my password be?",
+		Context:   "[1] Password Policy (document 1)\nPasswords must be at least 12 characters long.",
+		History:   "Employee: Hello\nAssistant: Hi!\n",
+		Date:      time.Now().Format("2006-01-02"),
+	})
+	return err
+}
+
+// Prompt template handlers (Admin only)
+
+// List prompt templates, optionally filtered by name
+func handleGetPromptTemplates(c *gin.Context) {
+	query := db.Model(&PromptTemplate{})
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	var templates []PromptTemplate
+	if err := query.Order("name ASC, version DESC").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prompt templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prompt_templates": templates})
+}
+
+// Get a single prompt template version
+func handleGetPromptTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prompt template ID"})
+		return
+	}
+
+	var template PromptTemplate
+	if err := db.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prompt template"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// Create the next version of a prompt template
+func handleCreatePromptTemplate(c *gin.Context) {
+	var req CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Temperature must be between 0 and 2"})
+		return
+	}
+	if req.MaxTokens != nil && *req.MaxTokens <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_tokens must be positive"})
+		return
+	}
+	if (req.Provider == "") != (req.Model == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider and model must be set together"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	username, _ := c.Get("username")
+	uid := userID.(uint)
+
+	template := PromptTemplate{
+		Name:            strings.TrimSpace(req.Name),
+		SystemPrompt:    req.SystemPrompt,
+		Template:        req.Template,
+		Provider:        req.Provider,
+		Model:           req.Model,
+		Temperature:     req.Temperature,
+		MaxTokens:       req.MaxTokens,
+		ChangeNote:      req.ChangeNote,
+		IsActive:        req.Activate,
+		CreatedBy:       username.(string),
+		CreatedByUserID: &uid,
+	}
+
+	if err := validatePromptTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&PromptTemplate{}).Where("name = ?", template.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		template.Version = latest + 1
+
+		if template.IsActive {
+			if err := tx.Model(&PromptTemplate{}).Where("name = ?", template.Name).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create prompt template"})
+		return
+	}
+
+	logAuditActivity(c, uid, ActionCreate, ResourcePromptTemplate, &template.ID, template.Name,
+		fmt.Sprintf("Created prompt template %s v%d (active: %t)", template.Name, template.Version, template.IsActive))
+
+	c.JSON(http.StatusCreated, template)
+}
+
+// Make a prompt template version the active one for its name
+func handleActivatePromptTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prompt template ID"})
+		return
+	}
+
+	var template PromptTemplate
+	if err := db.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prompt template"})
+		}
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PromptTemplate{}).Where("name = ?", template.Name).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&template).Update("is_active", true).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate prompt template"})
+		return
+	}
+	template.IsActive = true
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionUpdate, ResourcePromptTemplate, &template.ID, template.Name,
+		fmt.Sprintf("Activated prompt template %s v%d", template.Name, template.Version))
+
+	c.JSON(http.StatusOK, template)
+}
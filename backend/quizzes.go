@@ -0,0 +1,790 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Quiz model for a knowledge check on one policy document.
+// Drafts are only visible to admins until they are published.
+type Quiz struct {
+	ID              uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	DocumentID      uint           `json:"document_id" gorm:"not null;index"`
+	Document        PolicyFile     `json:"-" gorm:"foreignKey:DocumentID"`
+	DocumentVersion int            `json:"document_version"` // Version of the document the questions were written for
+	Title           string         `json:"title" gorm:"not null;size:255"`
+	Description     string         `json:"description" gorm:"type:text"`
+	PassThreshold   int            `json:"pass_threshold" gorm:"not null;default:80"` // Percentage of correct answers needed to pass
+	MaxAttempts     int            `json:"max_attempts" gorm:"default:0"`             // 0 for unlimited
+	IsPublished     bool           `json:"is_published" gorm:"default:false;index"`
+	IsActive        bool           `json:"is_active" gorm:"default:true;index"`
+	GeneratedBy     string         `json:"generated_by,omitempty" gorm:"size:100"` // LLM provider/model that drafted the questions
+	CreatedBy       string         `json:"created_by" gorm:"size:100"`
+	Questions       []QuizQuestion `json:"questions,omitempty" gorm:"foreignKey:QuizID"`
+	CreatedAt       time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// QuizQuestion model for one multiple-choice question
+type QuizQuestion struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	QuizID        uint      `json:"quiz_id" gorm:"not null;index"`
+	Position      int       `json:"position" gorm:"not null"`
+	Question      string    `json:"question" gorm:"type:text;not null"`
+	OptionsJSON   string    `json:"-" gorm:"column:options;type:text;not null"` // Store as JSON string in DB
+	Options       []string  `json:"options" gorm:"-"`                           // For JSON response
+	CorrectOption int       `json:"correct_option"`                             // Index into Options
+	Explanation   string    `json:"explanation,omitempty" gorm:"type:text"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// QuizAttempt model for a graded submission
+type QuizAttempt struct {
+	ID              uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	QuizID          uint       `json:"quiz_id" gorm:"not null;index"`
+	Quiz            Quiz       `json:"-" gorm:"foreignKey:QuizID"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	User            User       `json:"-" gorm:"foreignKey:UserID"`
+	AnswersJSON     string     `json:"-" gorm:"column:answers;type:text"` // Store as JSON string in DB
+	Answers         []int      `json:"answers" gorm:"-"`                  // For JSON response
+	Correct         int        `json:"correct"`
+	Total           int        `json:"total"`
+	Score           float64    `json:"score"` // Percentage, 0-100
+	Passed          bool       `json:"passed" gorm:"index"`
+	DocumentVersion int        `json:"document_version"`
+	ResetAt         *time.Time `json:"reset_at,omitempty"` // Set when an admin resets attempts; no longer counts toward MaxAttempts
+	CreatedAt       time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// Request structures for quiz management
+type QuizQuestionRequest struct {
+	Question      string   `json:"question" binding:"required"`
+	Options       []string `json:"options" binding:"required"`
+	CorrectOption int      `json:"correct_option"`
+	Explanation   string   `json:"explanation"`
+}
+
+type QuizRequest struct {
+	DocumentID    uint                  `json:"document_id" binding:"required"`
+	Title         string                `json:"title" binding:"required"`
+	Description   string                `json:"description"`
+	PassThreshold int                   `json:"pass_threshold"`
+	MaxAttempts   int                   `json:"max_attempts"`
+	IsPublished   bool                  `json:"is_published"`
+	Questions     []QuizQuestionRequest `json:"questions" binding:"required"`
+}
+
+type DraftQuizRequest struct {
+	DocumentID    uint `json:"document_id" binding:"required"`
+	QuestionCount int  `json:"question_count"` // Defaults to 5, at most 10
+}
+
+type ResetQuizAttemptsRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+type QuizAttemptRequest struct {
+	Answers []int `json:"answers" binding:"required"` // Chosen option index per question, in order
+}
+
+// Graded answer returned after an attempt
+type QuizAnswerResult struct {
+	QuestionID    uint   `json:"question_id"`
+	Chosen        int    `json:"chosen"`
+	CorrectOption int    `json:"correct_option"`
+	Correct       bool   `json:"correct"`
+	Explanation   string `json:"explanation,omitempty"`
+}
+
+// Quiz limits
+const (
+	defaultQuizQuestions = 5
+	maxQuizQuestions     = 10
+	defaultPassThreshold = 80
+)
+
+// Helper methods for QuizQuestion and QuizAttempt
+func (q *QuizQuestion) BeforeSave(tx *gorm.DB) error {
+	optionsJSON, err := json.Marshal(q.Options)
+	if err != nil {
+		return err
+	}
+	q.OptionsJSON = string(optionsJSON)
+	return nil
+}
+
+func (q *QuizQuestion) AfterFind(tx *gorm.DB) error {
+	if err := json.Unmarshal([]byte(q.OptionsJSON), &q.Options); err != nil {
+		q.Options = []string{}
+	}
+	return nil
+}
+
+func (a *QuizAttempt) BeforeSave(tx *gorm.DB) error {
+	answersJSON, err := json.Marshal(a.Answers)
+	if err != nil {
+		return err
+	}
+	a.AnswersJSON = string(answersJSON)
+	return nil
+}
+
+func (a *QuizAttempt) AfterFind(tx *gorm.DB) error {
+	if a.AnswersJSON != "" {
+		if err := json.Unmarshal([]byte(a.AnswersJSON), &a.Answers); err != nil {
+			a.Answers = nil
+		}
+	}
+	return nil
+}
+
+// Users who can author quizzes and see answer keys
+func canManageQuizzes(c *gin.Context) bool {
+	role, _ := c.Get("user_role")
+	return role == RoleAdmin || role == RoleITSecurity || role == RoleHR
+}
+
+// Hide the answer key from quiz takers
+func (q Quiz) withoutAnswers() Quiz {
+	questions := make([]QuizQuestion, len(q.Questions))
+	for i, question := range q.Questions {
+		question.CorrectOption = -1
+		question.Explanation = ""
+		questions[i] = question
+	}
+	q.Questions = questions
+	return q
+}
+
+// Validate questions and build them in the requested order
+func quizQuestionsFromRequest(requests []QuizQuestionRequest) ([]QuizQuestion, error) {
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("a quiz needs at least one question")
+	}
+
+	questions := make([]QuizQuestion, 0, len(requests))
+	for i, req := range requests {
+		text := strings.TrimSpace(req.Question)
+		if text == "" {
+			return nil, fmt.Errorf("question %d is empty", i+1)
+		}
+		if len(req.Options) < 2 || len(req.Options) > 6 {
+			return nil, fmt.Errorf("question %d needs between 2 and 6 options", i+1)
+		}
+		options := make([]string, len(req.Options))
+		for j, option := range req.Options {
+			options[j] = strings.TrimSpace(option)
+			if options[j] == "" {
+				return nil, fmt.Errorf("question %d has an empty option", i+1)
+			}
+		}
+		if req.CorrectOption < 0 || req.CorrectOption >= len(options) {
+			return nil, fmt.Errorf("question %d has no valid correct option", i+1)
+		}
+
+		questions = append(questions, QuizQuestion{
+			Position:      i + 1,
+			Question:      text,
+			Options:       options,
+			CorrectOption: req.CorrectOption,
+			Explanation:   strings.TrimSpace(req.Explanation),
+		})
+	}
+	return questions, nil
+}
+
+// Validate the quiz settings of a request
+func validateQuizRequest(req *QuizRequest) error {
+	if req.PassThreshold == 0 {
+		req.PassThreshold = defaultPassThreshold
+	}
+	if req.PassThreshold < 1 || req.PassThreshold > 100 {
+		return fmt.Errorf("pass_threshold must be between 1 and 100")
+	}
+	if req.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts cannot be negative")
+	}
+	return nil
+}
+
+// Prompt asking the LLM for multiple-choice questions about a document
+func quizDraftPrompt(document PolicyFile, count int) LLMRequest {
+	temperature, maxTokens := 0.3, 400*count
+	return LLMRequest{
+		System: "You write knowledge-check quizzes that verify employees understood company security policies. " +
+			"Only ask about facts stated in the policy. Reply with JSON only.",
+		Prompt: fmt.Sprintf(`Write %d multiple-choice questions about the policy below. Each question has exactly 4 options and one correct answer.
+Reply with a JSON array and nothing else, in this format:
+[{"question": "...", "options": ["...", "...", "...", "..."], "correct_option": 0, "explanation": "..."}]
+"correct_option" is the zero-based index of the correct option. "explanation" quotes or paraphrases the policy sentence that answers the question.
+
+Policy: %s
+
+%s`, count, document.Name, document.Content),
+		Question:    "Write a quiz about " + document.Name,
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+	}
+}
+
+// Extract the question list from an LLM reply, tolerating text around the JSON
+func parseQuizDraft(text string) ([]QuizQuestionRequest, error) {
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("no JSON array in the reply")
+	}
+
+	var questions []QuizQuestionRequest
+	if err := json.Unmarshal([]byte(text[start:end+1]), &questions); err != nil {
+		return nil, fmt.Errorf("invalid JSON in the reply: %v", err)
+	}
+	return questions, nil
+}
+
+// Mark onboarding steps gated by a quiz complete once the user passes it
+func completeQuizOnboardingSteps(user User, quizID uint) {
+	var steps []OnboardingStep
+	if err := db.Where("quiz_id = ?", quizID).Find(&steps).Error; err != nil || len(steps) == 0 {
+		return
+	}
+
+	for _, step := range steps {
+		assignments, err := loadOnboardingAssignments(db.Where("user_id = ? AND program_id = ?", user.ID, step.ProgramID))
+		if err != nil || len(assignments) == 0 {
+			continue
+		}
+		progress := OnboardingProgress{AssignmentID: assignments[0].ID, StepID: step.ID, CompletedAt: time.Now()}
+		if err := db.Where("assignment_id = ? AND step_id = ?", assignments[0].ID, step.ID).FirstOrCreate(&progress).Error; err != nil {
+			continue
+		}
+		refreshAssignmentCompletion(assignments[0], user.Role)
+	}
+}
+
+// Remove a quiz users can no longer take from the onboarding steps it gates,
+// so those steps can be completed without it. Returns the number of steps.
+func releaseQuizOnboardingSteps(quizID uint) (int64, error) {
+	var programIDs []uint
+	if err := db.Model(&OnboardingStep{}).Where("quiz_id = ?", quizID).Distinct().Pluck("program_id", &programIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(programIDs) == 0 {
+		return 0, nil
+	}
+
+	result := db.Model(&OnboardingStep{}).Where("quiz_id = ?", quizID).Update("quiz_id", nil)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, refreshAssignmentsCompletion(db.Where("program_id IN ?", programIDs))
+}
+
+// Whether a user has passed a quiz
+func hasPassedQuiz(userID, quizID uint) bool {
+	var count int64
+	db.Model(&QuizAttempt{}).Where("user_id = ? AND quiz_id = ? AND passed = ?", userID, quizID, true).Count(&count)
+	return count > 0
+}
+
+// Quiz handlers
+
+// List quizzes: published quizzes with the user's best result, or all quizzes
+// for quiz managers with ?all=true. Filter by document with document_id.
+func handleGetQuizzes(c *gin.Context) {
+	query := db.Model(&Quiz{}).Where("is_active = ?", true)
+	if !(c.Query("all") == "true" && canManageQuizzes(c)) {
+		query = query.Where("is_published = ?", true)
+	}
+	if documentID := c.Query("document_id"); documentID != "" {
+		query = query.Where("document_id = ?", documentID)
+	}
+
+	var quizzes []Quiz
+	if err := query.Preload("Document", func(tx *gorm.DB) *gorm.DB {
+		return tx.Select("id", "name", "version")
+	}).Order("title ASC").Find(&quizzes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quizzes"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	var attempts []QuizAttempt
+	db.Where("user_id = ?", userID).Order("score DESC").Find(&attempts)
+	best := make(map[uint]QuizAttempt)
+	count := make(map[uint]int)
+	for _, attempt := range attempts {
+		if _, exists := best[attempt.QuizID]; !exists {
+			best[attempt.QuizID] = attempt
+		}
+		count[attempt.QuizID]++
+	}
+
+	type quizSummary struct {
+		Quiz
+		DocumentName string       `json:"document_name"`
+		Outdated     bool         `json:"outdated"` // The document changed after the questions were written
+		Attempts     int          `json:"attempts"`
+		BestAttempt  *QuizAttempt `json:"best_attempt,omitempty"`
+	}
+	summaries := make([]quizSummary, 0, len(quizzes))
+	for _, quiz := range quizzes {
+		summary := quizSummary{
+			Quiz:         quiz,
+			DocumentName: quiz.Document.Name,
+			Outdated:     quiz.Document.Version > quiz.DocumentVersion,
+			Attempts:     count[quiz.ID],
+		}
+		if attempt, exists := best[quiz.ID]; exists {
+			summary.BestAttempt = &attempt
+		}
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quizzes": summaries})
+}
+
+// Get a quiz with its questions. The answer key is only included for quiz managers.
+func handleGetQuiz(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	manager := canManageQuizzes(c)
+	query := db.Preload("Questions", func(tx *gorm.DB) *gorm.DB { return tx.Order("position ASC") })
+	if !manager {
+		query = query.Where("is_published = ? AND is_active = ?", true, true)
+	}
+
+	var quiz Quiz
+	if err := query.First(&quiz, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quiz"})
+		}
+		return
+	}
+
+	if !manager {
+		quiz = quiz.withoutAnswers()
+	}
+	c.JSON(http.StatusOK, quiz)
+}
+
+// Submit answers to a quiz, grade them and store the attempt
+func handleSubmitQuizAttempt(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	var req QuizAttemptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var quiz Quiz
+	err = db.Preload("Questions", func(tx *gorm.DB) *gorm.DB { return tx.Order("position ASC") }).
+		Preload("Document", func(tx *gorm.DB) *gorm.DB { return tx.Select("id", "name", "version") }).
+		Where("is_published = ? AND is_active = ?", true, true).
+		First(&quiz, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quiz"})
+		}
+		return
+	}
+
+	if len(req.Answers) != len(quiz.Questions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Expected %d answers, got %d", len(quiz.Questions), len(req.Answers))})
+		return
+	}
+
+	user := currentUser(c)
+	if quiz.MaxAttempts > 0 {
+		var attempts int64
+		db.Model(&QuizAttempt{}).Where("user_id = ? AND quiz_id = ? AND reset_at IS NULL", user.ID, quiz.ID).Count(&attempts)
+		if attempts >= int64(quiz.MaxAttempts) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You have used all attempts for this quiz. Ask an administrator to reset them."})
+			return
+		}
+	}
+
+	results := make([]QuizAnswerResult, len(quiz.Questions))
+	correct := 0
+	for i, question := range quiz.Questions {
+		chosen := req.Answers[i]
+		if chosen < 0 || chosen >= len(question.Options) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Answer %d is not a valid option", i+1)})
+			return
+		}
+		results[i] = QuizAnswerResult{
+			QuestionID:    question.ID,
+			Chosen:        chosen,
+			CorrectOption: question.CorrectOption,
+			Correct:       chosen == question.CorrectOption,
+			Explanation:   question.Explanation,
+		}
+		if results[i].Correct {
+			correct++
+		}
+	}
+
+	attempt := QuizAttempt{
+		QuizID:          quiz.ID,
+		UserID:          user.ID,
+		Answers:         req.Answers,
+		Correct:         correct,
+		Total:           len(quiz.Questions),
+		Score:           float64(correct) * 100 / float64(len(quiz.Questions)),
+		DocumentVersion: quiz.Document.Version,
+	}
+	attempt.Passed = attempt.Score >= float64(quiz.PassThreshold)
+
+	if err := db.Create(&attempt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attempt"})
+		return
+	}
+
+	outcome := "failed"
+	if attempt.Passed {
+		outcome = "passed"
+		completeQuizOnboardingSteps(user, quiz.ID)
+	}
+	logAuditActivity(c, user.ID, ActionCreate, ResourceQuiz, &quiz.ID, quiz.Title,
+		fmt.Sprintf("Quiz attempt %s: %d/%d correct (%.0f%%, pass mark %d%%)", outcome, correct, attempt.Total, attempt.Score, quiz.PassThreshold))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"attempt": attempt,
+		"results": results,
+	})
+}
+
+// List the current user's attempts
+func handleGetMyQuizAttempts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var attempts []QuizAttempt
+	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// Quiz management handlers (Admin only)
+
+func handleCreateQuiz(c *gin.Context) {
+	var req QuizRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateQuizRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	questions, err := quizQuestionsFromRequest(req.Questions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var document PolicyFile
+	if err := db.First(&document, req.DocumentID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document not found"})
+		return
+	}
+
+	user := currentUser(c)
+	quiz := Quiz{
+		DocumentID:      document.ID,
+		DocumentVersion: document.Version,
+		Title:           strings.TrimSpace(req.Title),
+		Description:     req.Description,
+		PassThreshold:   req.PassThreshold,
+		MaxAttempts:     req.MaxAttempts,
+		IsPublished:     req.IsPublished,
+		IsActive:        true,
+		CreatedBy:       user.Username,
+		Questions:       questions,
+	}
+	if err := db.Create(&quiz).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create quiz"})
+		return
+	}
+
+	logAuditActivity(c, user.ID, ActionCreate, ResourceQuiz, &quiz.ID, quiz.Title,
+		fmt.Sprintf("Created quiz %s for %s with %d questions (published: %t)", quiz.Title, document.Name, len(questions), quiz.IsPublished))
+
+	c.JSON(http.StatusCreated, quiz)
+}
+
+// Replace a quiz's settings and questions. Existing attempts keep their scores.
+func handleUpdateQuiz(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	var quiz Quiz
+	if err := db.First(&quiz, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return
+	}
+
+	var req QuizRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateQuizRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	questions, err := quizQuestionsFromRequest(req.Questions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var document PolicyFile
+	if err := db.First(&document, req.DocumentID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document not found"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("quiz_id = ?", quiz.ID).Delete(&QuizQuestion{}).Error; err != nil {
+			return err
+		}
+		for i := range questions {
+			questions[i].QuizID = quiz.ID
+		}
+		if err := tx.Create(&questions).Error; err != nil {
+			return err
+		}
+
+		// Reviewing the questions brings them up to date with the document
+		quiz.DocumentID = document.ID
+		quiz.DocumentVersion = document.Version
+		quiz.Title = strings.TrimSpace(req.Title)
+		quiz.Description = req.Description
+		quiz.PassThreshold = req.PassThreshold
+		quiz.MaxAttempts = req.MaxAttempts
+		quiz.IsPublished = req.IsPublished
+		return tx.Save(&quiz).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quiz"})
+		return
+	}
+	quiz.Questions = questions
+
+	details := fmt.Sprintf("Updated quiz %s (%d questions, published: %t)", quiz.Title, len(questions), quiz.IsPublished)
+	if !quiz.IsPublished {
+		released, err := releaseQuizOnboardingSteps(quiz.ID)
+		if err != nil {
+			log.Printf("Failed to release onboarding steps gated by quiz %d: %v", quiz.ID, err)
+		} else if released > 0 {
+			details += fmt.Sprintf(", no longer gates %d onboarding steps", released)
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionUpdate, ResourceQuiz, &quiz.ID, quiz.Title, details)
+
+	c.JSON(http.StatusOK, quiz)
+}
+
+// Deactivate a quiz (soft delete); attempts are kept for the audit trail
+func handleDeleteQuiz(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	var quiz Quiz
+	if err := db.First(&quiz, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return
+	}
+
+	if err := db.Model(&quiz).Update("is_active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete quiz"})
+		return
+	}
+
+	details := fmt.Sprintf("Deactivated quiz %s", quiz.Title)
+	released, err := releaseQuizOnboardingSteps(quiz.ID)
+	if err != nil {
+		log.Printf("Failed to release onboarding steps gated by quiz %d: %v", quiz.ID, err)
+	} else if released > 0 {
+		details += fmt.Sprintf(", no longer gates %d onboarding steps", released)
+	}
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionDelete, ResourceQuiz, &quiz.ID, quiz.Title, details)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Quiz deleted successfully"})
+}
+
+// Have the LLM draft questions from a document. The draft is saved unpublished for review.
+func handleDraftQuiz(c *gin.Context) {
+	var req DraftQuizRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.QuestionCount == 0 {
+		req.QuestionCount = defaultQuizQuestions
+	}
+	if req.QuestionCount < 1 || req.QuestionCount > maxQuizQuestions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("question_count must be between 1 and %d", maxQuizQuestions)})
+		return
+	}
+
+	var document PolicyFile
+	if err := db.First(&document, req.DocumentID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document not found"})
+		return
+	}
+
+	user := currentUser(c)
+	llmRequest := quizDraftPrompt(document, req.QuestionCount)
+	response, err := callModelLLM(c.Request.Context(), llmRequest)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No LLM provider is available to draft questions"})
+		return
+	}
+	recordLLMUsage(user.ID, llmRequest, response)
+
+	var questions []QuizQuestion
+	drafted, err := parseQuizDraft(response.Text)
+	if err == nil {
+		if len(drafted) > req.QuestionCount {
+			drafted = drafted[:req.QuestionCount]
+		}
+		questions, err = quizQuestionsFromRequest(drafted)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("The LLM did not return usable questions: %v", err)})
+		return
+	}
+
+	quiz := Quiz{
+		DocumentID:      document.ID,
+		DocumentVersion: document.Version,
+		Title:           document.Name + " knowledge check",
+		PassThreshold:   defaultPassThreshold,
+		IsActive:        true,
+		GeneratedBy:     response.Provider + "/" + response.Model,
+		CreatedBy:       user.Username,
+		Questions:       questions,
+	}
+	if err := db.Create(&quiz).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save draft quiz"})
+		return
+	}
+
+	logAuditActivity(c, user.ID, ActionCreate, ResourceQuiz, &quiz.ID, quiz.Title,
+		fmt.Sprintf("Drafted quiz for %s with %d questions using %s", document.Name, len(questions), quiz.GeneratedBy))
+
+	c.JSON(http.StatusCreated, quiz)
+}
+
+// Attempts at a quiz by all users (Admin only)
+func handleGetQuizAttempts(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	query := db.Where("quiz_id = ?", id)
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var attempts []QuizAttempt
+	if err := query.Preload("User").Order("created_at DESC").Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempts"})
+		return
+	}
+
+	type attemptWithUser struct {
+		QuizAttempt
+		User UserInfo `json:"user"`
+	}
+	result := make([]attemptWithUser, 0, len(attempts))
+	passed := make(map[uint]bool)
+	for _, attempt := range attempts {
+		result = append(result, attemptWithUser{QuizAttempt: attempt, User: userToUserInfo(attempt.User)})
+		if attempt.Passed {
+			passed[attempt.UserID] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts":     result,
+		"total":        len(result),
+		"users_passed": len(passed),
+	})
+}
+
+// Give a user a fresh set of attempts at a quiz (Admin only). Earlier attempts
+// are kept for the audit trail but no longer count toward the limit.
+func handleResetQuizAttempts(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return
+	}
+
+	var req ResetQuizAttemptsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var quiz Quiz
+	if err := db.First(&quiz, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return
+	}
+	var user User
+	if err := db.First(&user, req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	result := db.Model(&QuizAttempt{}).Where("user_id = ? AND quiz_id = ? AND reset_at IS NULL", user.ID, quiz.ID).
+		UpdateColumn("reset_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset attempts"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	logAuditActivity(c, userID.(uint), ActionUpdate, ResourceQuiz, &quiz.ID, quiz.Title,
+		fmt.Sprintf("Reset %d attempts at quiz %s for user %s", result.RowsAffected, quiz.Title, user.Username))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attempts reset", "reset": result.RowsAffected})
+}
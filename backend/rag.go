@@ -0,0 +1,224 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Retrieval-augmented generation (RAG) configuration
+type RAGConfig struct {
+	ChunkSize     int // Target chunk size in characters
+	ChunkOverlap  int // Characters carried over between consecutive chunks
+	CandidateDocs int // Documents taken from the search engine before chunking
+	TopK          int // Maximum number of passages placed in the prompt
+	ContextTokens int // Token budget for the retrieved passages
+}
+
+// DocumentChunk is a contiguous passage of PolicyFile.Content
+type DocumentChunk struct {
+	DocumentID   uint
+	DocumentName string
+	Index        int
+	Start        int // Byte offset into PolicyFile.Content
+	End          int
+	Text         string
+}
+
+// RetrievedPassage is a chunk selected for a question together with its relevance
+type RetrievedPassage struct {
+	DocumentChunk
+	Score float64
+}
+
+// ChatSource describes a passage that was given to the LLM when answering
+type ChatSource struct {
+	DocumentID   uint    `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	ChunkIndex   int     `json:"chunk_index"`
+	Start        int     `json:"start"`
+	End          int     `json:"end"`
+	Score        float64 `json:"score"`
+}
+
+var sentencePattern = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+
+func loadRAGConfig() RAGConfig {
+	return RAGConfig{
+		ChunkSize:     getEnvInt("RAG_CHUNK_SIZE", 800),
+		ChunkOverlap:  getEnvInt("RAG_CHUNK_OVERLAP", 150),
+		CandidateDocs: getEnvInt("RAG_CANDIDATE_DOCS", 5),
+		TopK:          getEnvInt("RAG_TOP_K", 4),
+		ContextTokens: getEnvInt("RAG_CONTEXT_TOKENS", 1500),
+	}
+}
+
+// Rough token estimate (~4 characters per token for English text)
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Split text into sentence spans, returned as [start, end) byte offsets
+func sentenceSpans(text string) [][2]int {
+	var spans [][2]int
+	for _, loc := range sentencePattern.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		// Trim surrounding whitespace so offsets point at the sentence itself
+		for start < end && isSpaceByte(text[start]) {
+			start++
+		}
+		for end > start && isSpaceByte(text[end-1]) {
+			end--
+		}
+		if start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+	return spans
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// Split a document into overlapping chunks along sentence boundaries
+func chunkDocument(doc PolicyFile, size, overlap int) []DocumentChunk {
+	if size <= 0 {
+		size = 800
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	spans := sentenceSpans(doc.Content)
+	var chunks []DocumentChunk
+
+	for i := 0; i < len(spans); {
+		start := spans[i][0]
+		end := spans[i][1]
+		j := i + 1
+		for j < len(spans) && spans[j][1]-start <= size {
+			end = spans[j][1]
+			j++
+		}
+
+		chunks = append(chunks, DocumentChunk{
+			DocumentID:   doc.ID,
+			DocumentName: doc.Name,
+			Index:        len(chunks),
+			Start:        start,
+			End:          end,
+			Text:         doc.Content[start:end],
+		})
+
+		if j >= len(spans) {
+			break
+		}
+
+		// Step back so the next chunk repeats up to `overlap` characters
+		next := j
+		for next-1 > i && end-spans[next-1][0] <= overlap {
+			next--
+		}
+		i = next
+	}
+
+	return chunks
+}
+
+// Distinct normalized terms of a text
+func termSet(text string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, word := range tokenize(text) {
+		terms[normalizeWord(word)] = true
+	}
+	return terms
+}
+
+// Retrieve the most relevant passages for a question within the configured budget
+func retrievePassages(engine *SearchEngine, question string, config RAGConfig) []RetrievedPassage {
+	matches := engine.Search(question, config.CandidateDocs)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	queryTerms := termSet(question)
+	maxDocScore := matches[0].Score
+
+	var candidates []RetrievedPassage
+	for _, match := range matches {
+		docWeight := 0.0
+		if maxDocScore > 0 {
+			docWeight = match.Score / maxDocScore
+		}
+
+		chunks := chunkDocument(match.Document, config.ChunkSize, config.ChunkOverlap)
+		anyOverlap := false
+		var scored []RetrievedPassage
+
+		for _, chunk := range chunks {
+			chunkTerms := termSet(chunk.Text)
+			hits := 0
+			for term := range queryTerms {
+				if chunkTerms[term] {
+					hits++
+				}
+			}
+
+			coverage := 0.0
+			if len(queryTerms) > 0 {
+				coverage = float64(hits) / float64(len(queryTerms))
+			}
+			if hits > 0 {
+				anyOverlap = true
+			}
+
+			scored = append(scored, RetrievedPassage{
+				DocumentChunk: chunk,
+				Score:         coverage + 0.5*docWeight,
+			})
+		}
+
+		for _, passage := range scored {
+			// Documents that matched only on name, tags or category still contribute their opening chunk
+			if passage.Score > 0.5*docWeight || (!anyOverlap && passage.Index == 0) {
+				candidates = append(candidates, passage)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	var selected []RetrievedPassage
+	usedTokens := 0
+	for _, passage := range candidates {
+		if len(selected) >= config.TopK {
+			break
+		}
+		tokens := estimateTokens(passage.Text)
+		if usedTokens+tokens > config.ContextTokens {
+			continue
+		}
+		usedTokens += tokens
+		selected = append(selected, passage)
+	}
+
+	return selected
+}
+
+// Convert retrieved passages into response sources
+func passagesToSources(passages []RetrievedPassage) []ChatSource {
+	var sources []ChatSource
+	for _, passage := range passages {
+		sources = append(sources, ChatSource{
+			DocumentID:   passage.DocumentID,
+			DocumentName: passage.DocumentName,
+			ChunkIndex:   passage.Index,
+			Start:        passage.Start,
+			End:          passage.End,
+			Score:        passage.Score,
+		})
+	}
+	return sources
+}
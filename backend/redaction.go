@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of sensitive data removed before a prompt leaves the network
+const (
+	RedactEmail      = "EMAIL"
+	RedactPhone      = "PHONE"
+	RedactCreditCard = "CREDIT_CARD"
+	RedactNationalID = "NATIONAL_ID"
+	RedactEmployeeID = "EMPLOYEE_ID"
+	RedactAPIKey     = "API_KEY"
+	RedactPassword   = "PASSWORD"
+)
+
+// Redaction modes accepted in LLM_REDACTION and LLM_<NAME>_REDACTION
+const (
+	RedactionAuto   = "auto" // Redact for providers that are not on a local or private network
+	RedactionAlways = "always"
+	RedactionNever  = "never"
+)
+
+// Detector for one kind of sensitive data
+type redactionRule struct {
+	Kind    string
+	Pattern *regexp.Regexp
+	Group   int                     // Submatch to replace, 0 for the whole match
+	Valid   func(value string) bool // Optional check to cut false positives
+	Restore bool                    // Whether the original may be put back into the answer
+}
+
+// Secrets are never restored: the answer only needs to refer to them, not repeat them.
+// Rules run in order, so specific formats come before the broad number patterns.
+var redactionRules = []redactionRule{
+	{Kind: RedactAPIKey, Pattern: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|ghp_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,}|AKIA[0-9A-Z]{16}|xox[abpr]-[A-Za-z0-9-]{10,}|hf_[A-Za-z0-9]{30,}|AIza[0-9A-Za-z_-]{35}|eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,})`)},
+	{Kind: RedactAPIKey, Pattern: regexp.MustCompile(`(?i)\b(?:api[_ -]?key|access[_ -]?key|secret(?:[_ -]?key)?|token|bearer)\b\s*(?:is|:|=)?\s*["']?([A-Za-z0-9_\-./+=]{16,})`), Group: 1},
+	{Kind: RedactPassword, Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|passcode|passphrase|pin)\b\s*(?:is|was|:|=)\s*["']?([^\s"']{3,}[^\s"'.,;:!?)])`), Group: 1, Valid: looksLikeSecret},
+	{Kind: RedactEmail, Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), Restore: true},
+	{Kind: RedactCreditCard, Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Valid: luhnValid},
+	{Kind: RedactNationalID, Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b|\b\d{16}\b|\b[A-CEGHJ-PR-TW-Z]{2}\d{6}[A-D]\b`)},
+	{Kind: RedactPhone, Pattern: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\b\d{2,4}[\s.-]\d{3,4}[\s.-]?\d{3,4}\b|\+\d{8,15}\b`), Restore: true},
+	{Kind: RedactEmployeeID, Pattern: regexp.MustCompile(`(?i)\bemp(?:loyee)?[\s_-]?(?:id|no|number|#)?[\s:#-]*(\d{4,8})\b`), Group: 1, Restore: true},
+}
+
+// Matches placeholders such as [EMAIL_1]
+var placeholderPattern = regexp.MustCompile(`\[([A-Z_]+)_(\d+)\]`)
+
+// Whether a value looks like a credential rather than an ordinary word,
+// so "my password is Summer2024!" is redacted but "the password is required" is not
+func looksLikeSecret(value string) bool {
+	hasLower, hasUpper, hasOther := false, false, false
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		default:
+			hasOther = true
+		}
+	}
+	return hasOther || hasLower && hasUpper
+}
+
+// Luhn checksum, used to tell card numbers from other long digit runs
+func luhnValid(value string) bool {
+	var digits []int
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := digits[i]
+		if (len(digits)-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// Redactor replaces sensitive values with placeholders and remembers them for the answer.
+// One redactor is used per request so the same value always gets the same placeholder.
+type Redactor struct {
+	placeholders map[string]string // Original value -> placeholder
+	originals    map[string]string // Placeholder -> original value
+	restorable   map[string]bool   // Placeholder -> may be restored
+	counts       map[string]int    // Kind -> placeholders issued
+}
+
+func newRedactor() *Redactor {
+	return &Redactor{
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		restorable:   make(map[string]bool),
+		counts:       make(map[string]int),
+	}
+}
+
+// Redact sensitive values in a text
+func (r *Redactor) Redact(text string) string {
+	for _, rule := range redactionRules {
+		text = replaceSubmatch(rule.Pattern, text, rule.Group, func(value string) string {
+			if rule.Valid != nil && !rule.Valid(value) {
+				return value
+			}
+			return r.placeholder(rule, value)
+		})
+	}
+	return text
+}
+
+func (r *Redactor) placeholder(rule redactionRule, value string) string {
+	if placeholder, exists := r.placeholders[value]; exists {
+		return placeholder
+	}
+	r.counts[rule.Kind]++
+	placeholder := fmt.Sprintf("[%s_%d]", rule.Kind, r.counts[rule.Kind])
+	r.placeholders[value] = placeholder
+	r.originals[placeholder] = value
+	r.restorable[placeholder] = rule.Restore
+	return placeholder
+}
+
+// Restore placeholders in an answer. Secrets stay masked.
+func (r *Redactor) Restore(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		original, exists := r.originals[placeholder]
+		if !exists {
+			return placeholder
+		}
+		if r.restorable[placeholder] {
+			return original
+		}
+		kind := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return "[redacted " + strings.ToLower(strings.ReplaceAll(kind, "_", " ")) + "]"
+	})
+}
+
+// Number of values redacted per kind, for logging without the values themselves
+func (r *Redactor) Summary() string {
+	var kinds []string
+	for kind, count := range r.counts {
+		kinds = append(kinds, fmt.Sprintf("%s=%d", kind, count))
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds, ", ")
+}
+
+// Replace a submatch group (or the whole match for group 0) of every match
+func replaceSubmatch(pattern *regexp.Regexp, text string, group int, replace func(string) string) string {
+	var result strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2*group], loc[2*group+1]
+		if start < 0 {
+			continue
+		}
+		result.WriteString(text[last:start])
+		result.WriteString(replace(text[start:end]))
+		last = end
+	}
+	result.WriteString(text[last:])
+	return result.String()
+}
+
+// Restores placeholders in streamed tokens, holding back a possibly incomplete
+// placeholder until the token that closes it arrives
+type streamRestorer struct {
+	redactor *Redactor
+	pending  string
+}
+
+// Longest text held back while waiting for a closing bracket
+const maxPendingPlaceholder = 32
+
+func (s *streamRestorer) Write(token string) string {
+	s.pending += token
+	open := strings.LastIndex(s.pending, "[")
+	if open >= 0 && !strings.Contains(s.pending[open:], "]") && len(s.pending)-open < maxPendingPlaceholder {
+		ready := s.pending[:open]
+		s.pending = s.pending[open:]
+		return s.redactor.Restore(ready)
+	}
+	ready := s.pending
+	s.pending = ""
+	return s.redactor.Restore(ready)
+}
+
+func (s *streamRestorer) Flush() string {
+	ready := s.pending
+	s.pending = ""
+	return s.redactor.Restore(ready)
+}
+
+// redactingProvider removes sensitive data from prompts before they reach a provider
+// outside the local network and restores it in the answer
+type redactingProvider struct {
+	LLMProvider
+}
+
+func newRedactingProvider(provider LLMProvider) *redactingProvider {
+	return &redactingProvider{LLMProvider: provider}
+}
+
+func (p *redactingProvider) redact(req LLMRequest) (LLMRequest, *Redactor) {
+	redactor := newRedactor()
+	req.System = redactor.Redact(req.System)
+	req.Prompt = redactor.Redact(req.Prompt)
+	req.Question = redactor.Redact(req.Question)
+	if summary := redactor.Summary(); summary != "" {
+		log.Printf("🔏 Redacted before sending to %s: %s", p.Name(), summary)
+	}
+	return req, redactor
+}
+
+func (p *redactingProvider) Generate(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	redacted, redactor := p.redact(req)
+	response, err := p.LLMProvider.Generate(ctx, redacted)
+	if response != nil {
+		response.Text = redactor.Restore(response.Text)
+	}
+	return response, err
+}
+
+func (p *redactingProvider) Stream(ctx context.Context, req LLMRequest, onToken func(string) error) (*LLMResponse, error) {
+	redacted, redactor := p.redact(req)
+	restorer := &streamRestorer{redactor: redactor}
+
+	response, err := p.LLMProvider.Stream(ctx, redacted, func(token string) error {
+		if text := restorer.Write(token); text != "" {
+			return onToken(text)
+		}
+		return nil
+	})
+	if rest := restorer.Flush(); rest != "" && err == nil {
+		err = onToken(rest)
+	}
+	if response != nil {
+		response.Text = redactor.Restore(response.Text)
+	}
+	return response, err
+}
+
+// Whether prompts for a provider must be redacted. LLM_<NAME>_REDACTION overrides
+// LLM_REDACTION; in auto mode only endpoints on loopback or private networks are trusted.
+func shouldRedact(provider LLMProvider) bool {
+	name := provider.Name()
+	if name == ProviderMock {
+		return false
+	}
+
+	mode := strings.ToLower(getEnv("LLM_"+strings.ToUpper(name)+"_REDACTION", getEnv("LLM_REDACTION", RedactionAuto)))
+	switch mode {
+	case RedactionAlways:
+		return true
+	case RedactionNever:
+		return false
+	case RedactionAuto:
+	default:
+		log.Printf("Invalid redaction mode for %s: %q, using %s", name, mode, RedactionAuto)
+	}
+
+	return !isLocalEndpoint(provider.ModelInfo().Endpoint)
+}
+
+// Whether an endpoint URL points at this machine, a private network or a Docker service
+func isLocalEndpoint(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Hostname() == "" {
+		return false
+	}
+	host := parsed.Hostname()
+
+	if host == "localhost" || !strings.Contains(host, ".") && net.ParseIP(host) == nil {
+		return true // Single-label names such as "ollama" resolve inside the compose network
+	}
+	if strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Long-lived full-text index over the active documents. It is built once at
+// startup and kept current by the document handlers, which add, replace or
+// remove a single document rather than reloading every document per request.
+// Each server process holds its own index; after changing documents directly
+// in the database, rebuild it from the admin endpoint.
+
+type SearchEngine struct {
+	mu           sync.RWMutex
+	documents    map[uint]PolicyFile        // Indexed documents by ID
+	Index        map[string][]DocumentIndex // word -> document indices
+	terms        map[uint][]string          // Words each document is indexed under, for removal
+	fieldLengths map[uint]map[string]int    // Indexed words per document and field
+	fieldTotals  map[string]int             // Indexed words per field across all documents
+	built        bool
+	stats        SearchIndexStats
+}
+
+type DocumentIndex struct {
+	DocumentID int
+	Field      string
+	Frequency  int
+	Positions  []int // Word positions in the field, counting stop words, for phrase and proximity matching
+}
+
+// SearchIndexStats is reported on the admin endpoint
+type SearchIndexStats struct {
+	Documents         int        `json:"documents"`
+	Terms             int        `json:"terms"`
+	Postings          int        `json:"postings"` // (term, document, field) entries
+	Rebuilds          int        `json:"rebuilds"`
+	LastRebuildAt     *time.Time `json:"last_rebuild_at"`
+	RebuildDurationMs int64      `json:"rebuild_duration_ms"`
+	Updates           int        `json:"updates"` // Single documents added, reindexed or removed since startup
+	LastUpdateAt      *time.Time `json:"last_update_at"`
+
+	AverageFieldLengths map[string]float64 `json:"average_field_lengths"` // Words per document, used for length normalization
+}
+
+// Searchable document fields
+var searchFields = []string{"name", "description", "content", "category", "tags"}
+
+// SearchConfig tunes BM25F relevance scoring
+type SearchConfig struct {
+	K1          float64            // Term frequency saturation: higher values reward repetition longer
+	B           float64            // Field length normalization, from 0 (none) to 1 (full)
+	FieldBoosts map[string]float64 // Weight of a match in each field
+
+	ProximityWeight float64 // Bonus for query terms found close together, relative to their IDF
+	ProximityWindow int     // Most words a group of query terms may span to earn the bonus
+
+	SnippetLength int    // Approximate characters per result snippet
+	HighlightPre  string // Markers around highlighted words in snippets
+	HighlightPost string
+}
+
+func loadSearchConfig() SearchConfig {
+	return SearchConfig{
+		K1: math.Max(getEnvFloat("SEARCH_BM25_K1", 1.2), 0),
+		B:  math.Min(math.Max(getEnvFloat("SEARCH_BM25_B", 0.75), 0), 1),
+		FieldBoosts: map[string]float64{
+			"name":        getEnvFloat("SEARCH_BOOST_NAME", 3.0),
+			"description": getEnvFloat("SEARCH_BOOST_DESCRIPTION", 2.0),
+			"content":     getEnvFloat("SEARCH_BOOST_CONTENT", 1.0),
+			"category":    getEnvFloat("SEARCH_BOOST_CATEGORY", 2.5),
+			"tags":        getEnvFloat("SEARCH_BOOST_TAGS", 2.0),
+		},
+		ProximityWeight: math.Max(getEnvFloat("SEARCH_PROXIMITY_WEIGHT", 0.5), 0),
+		ProximityWindow: getEnvInt("SEARCH_PROXIMITY_WINDOW", 10),
+		SnippetLength:   getEnvInt("SEARCH_SNIPPET_LENGTH", 200),
+		HighlightPre:    getEnv("SEARCH_HIGHLIGHT_PRE", "<mark>"),
+		HighlightPost:   getEnv("SEARCH_HIGHLIGHT_POST", "</mark>"),
+	}
+}
+
+// Close spellings only count for part of an exact match
+const fuzzyTermWeight = 0.5
+
+var documentSearch = newSearchEngine()
+
+func newSearchEngine() *SearchEngine {
+	return &SearchEngine{
+		documents:    make(map[uint]PolicyFile),
+		Index:        make(map[string][]DocumentIndex),
+		terms:        make(map[uint][]string),
+		fieldLengths: make(map[uint]map[string]int),
+		fieldTotals:  make(map[string]int),
+	}
+}
+
+// Shared search engine, built from the database on first use
+func getSearchEngine() *SearchEngine {
+	documentSearch.mu.RLock()
+	built := documentSearch.built
+	documentSearch.mu.RUnlock()
+
+	if !built {
+		if err := documentSearch.Rebuild(); err != nil {
+			log.Printf("Failed to build search index: %v", err)
+		}
+	}
+	return documentSearch
+}
+
+// Reload every active document and rebuild the index from scratch. Searches
+// wait for the rebuild, so no document change can slip in between the reload
+// and the new index taking over.
+func (se *SearchEngine) Rebuild() error {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	started := time.Now()
+	var documents []PolicyFile
+	if err := db.Where("is_active = ?", true).Find(&documents).Error; err != nil {
+		return err
+	}
+
+	fresh := newSearchEngine()
+	se.documents, se.Index, se.terms = fresh.documents, fresh.Index, fresh.terms
+	se.fieldLengths, se.fieldTotals = fresh.fieldLengths, fresh.fieldTotals
+	for _, doc := range documents {
+		se.addDocument(doc)
+	}
+
+	now := time.Now()
+	se.built = true
+	se.stats.Rebuilds++
+	se.stats.LastRebuildAt = &now
+	se.stats.RebuildDurationMs = now.Sub(started).Milliseconds()
+	return nil
+}
+
+// Add a document or replace its previous version; inactive documents are removed
+func (se *SearchEngine) IndexDocument(doc PolicyFile) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	se.removeDocument(doc.ID)
+	if doc.IsActive {
+		se.addDocument(doc)
+	}
+	se.recordUpdate()
+}
+
+// Drop a document from the index
+func (se *SearchEngine) RemoveDocument(id uint) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	se.removeDocument(id)
+	se.recordUpdate()
+}
+
+func (se *SearchEngine) recordUpdate() {
+	now := time.Now()
+	se.stats.Updates++
+	se.stats.LastUpdateAt = &now
+}
+
+// Current size of the index and its maintenance history
+func (se *SearchEngine) Stats() SearchIndexStats {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+
+	stats := se.stats
+	stats.Documents = len(se.documents)
+	stats.Terms = len(se.Index)
+	for _, postings := range se.Index {
+		stats.Postings += len(postings)
+	}
+	stats.AverageFieldLengths = make(map[string]float64, len(searchFields))
+	for _, field := range searchFields {
+		stats.AverageFieldLengths[field] = se.averageFieldLength(field)
+	}
+	return stats
+}
+
+// Index the searchable fields of one document; the caller holds the write lock
+func (se *SearchEngine) addDocument(doc PolicyFile) {
+	se.documents[doc.ID] = doc
+
+	lengths := make(map[string]int, len(searchFields))
+	for _, field := range searchFields {
+		lengths[field] = se.indexField(int(doc.ID), field, documentFieldText(doc, field))
+		se.fieldTotals[field] += lengths[field]
+	}
+	se.fieldLengths[doc.ID] = lengths
+}
+
+// Remove every posting of one document; the caller holds the write lock
+func (se *SearchEngine) removeDocument(id uint) {
+	for _, word := range se.terms[id] {
+		postings := se.Index[word]
+		kept := postings[:0]
+		for _, posting := range postings {
+			if posting.DocumentID != int(id) {
+				kept = append(kept, posting)
+			}
+		}
+		if len(kept) == 0 {
+			delete(se.Index, word)
+		} else {
+			se.Index[word] = kept
+		}
+	}
+	for field, length := range se.fieldLengths[id] {
+		se.fieldTotals[field] -= length
+	}
+	delete(se.fieldLengths, id)
+	delete(se.terms, id)
+	delete(se.documents, id)
+}
+
+// Text of a searchable document field
+func documentFieldText(doc PolicyFile, field string) string {
+	switch field {
+	case "name":
+		return doc.Name
+	case "description":
+		return doc.Description
+	case "content":
+		return doc.Content
+	case "category":
+		return doc.Category
+	case "tags":
+		return strings.Join(doc.TagsArray, " ")
+	}
+	return ""
+}
+
+// A lowercased word of a field with its byte offsets in the field text
+type fieldToken struct {
+	word       string
+	start, end int
+}
+
+// Split text into words the same way as tokenize, keeping stop words and offsets
+func fieldTokens(text string) []fieldToken {
+	var tokens []fieldToken
+	start := -1
+	for i, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			tokens = append(tokens, fieldToken{word: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, fieldToken{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// Add the words of one field to the index and return how many were indexed
+func (se *SearchEngine) indexField(docID int, field, text string) int {
+	length := 0
+
+	for pos, token := range fieldTokens(text) {
+		if !isSearchableWord(token.word) {
+			continue
+		}
+		length++
+
+		word := normalizeWord(token.word)
+
+		// A document's postings are appended together, so only the tail can match
+		postings := se.Index[word]
+		found := false
+		for i := len(postings) - 1; i >= 0 && postings[i].DocumentID == docID; i-- {
+			if postings[i].Field == field {
+				postings[i].Frequency++
+				postings[i].Positions = append(postings[i].Positions, pos)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			if len(postings) == 0 || postings[len(postings)-1].DocumentID != docID {
+				se.terms[uint(docID)] = append(se.terms[uint(docID)], word)
+			}
+			se.Index[word] = append(postings, DocumentIndex{
+				DocumentID: docID,
+				Field:      field,
+				Frequency:  1,
+				Positions:  []int{pos},
+			})
+		}
+	}
+	return length
+}
+
+// Rank documents with BM25F: each query term's frequency is weighted by field
+// boost and normalized by field length before saturating, so a term repeated
+// across a long document counts for less than a match in a short title.
+// Quoted phrases must occur in a document and score as a single rare term;
+// documents where the other query terms appear close together rank higher.
+func (se *SearchEngine) Search(query string, limit int) []DocumentMatch {
+	if limit == 0 {
+		limit = 10
+	}
+
+	parsed := parseSearchQuery(query)
+	if len(parsed.Terms) == 0 && len(parsed.Phrases) == 0 {
+		return []DocumentMatch{}
+	}
+	config := loadSearchConfig()
+
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+
+	// Calculate document scores
+	docScores := make(map[int]float64)
+	docMatches := make(map[int][]Match)
+
+	// Every phrase narrows the documents that can match
+	var required map[int]bool
+	for _, phrase := range parsed.Phrases {
+		postings := se.findPhrase(phrase)
+		found := make(map[int]bool)
+		for _, posting := range postings {
+			found[posting.DocumentID] = true
+		}
+		if required == nil {
+			required = found
+		} else {
+			for docID := range required {
+				if !found[docID] {
+					delete(required, docID)
+				}
+			}
+		}
+		se.scorePostings(postings, phrase.Text, len(phrase.Words), se.inverseDocumentFrequencyOf(postings), 1, config, docScores, docMatches)
+	}
+
+	exact := make(map[string]bool)
+	for _, queryWord := range parsed.Terms {
+		// Try exact match first
+		if postings := se.Index[queryWord]; len(postings) > 0 {
+			exact[queryWord] = true
+			se.scorePostings(postings, queryWord, 0, se.inverseDocumentFrequency(queryWord), 1, config, docScores, docMatches)
+			continue
+		}
+
+		// If no exact matches, try fuzzy matching
+		for _, term := range se.findFuzzyTerms(queryWord, 2) { // max 2 edits
+			se.scorePostings(se.Index[term], term, 0, se.inverseDocumentFrequency(term), fuzzyTermWeight, config, docScores, docMatches)
+		}
+	}
+	se.scoreProximity(parsed.Terms, exact, config, docScores, docMatches)
+
+	if required != nil {
+		for docID := range docScores {
+			if !required[docID] {
+				delete(docScores, docID)
+			}
+		}
+	}
+	return se.rankResults(docScores, docMatches, limit, config)
+}
+
+// Turn document scores into the best results, highest score first
+func (se *SearchEngine) rankResults(docScores map[int]float64, docMatches map[int][]Match, limit int, config SearchConfig) []DocumentMatch {
+	var results []DocumentMatch
+	for docID, score := range docScores {
+		doc := se.getDocumentByID(uint(docID))
+		if doc != nil {
+			results = append(results, DocumentMatch{
+				Document: *doc,
+				Score:    score,
+				Matches:  docMatches[docID],
+			})
+		}
+	}
+
+	// Sort by relevance score (descending), then by ID for a stable order
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Document.ID < results[j].Document.ID
+	})
+
+	// Apply limit
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	for i := range results {
+		resolveMatchSpans(&results[i])
+		results[i].Snippets = buildSnippets(results[i], config)
+	}
+	return results
+}
+
+// Add the BM25F score of a term or phrase to every document in its postings,
+// with a match per field sharing the score in proportion to its contribution.
+// Phrase matches (spanWords > 0) report where their first occurrence is.
+func (se *SearchEngine) scorePostings(postings []DocumentIndex, text string, spanWords int, idf, weight float64, config SearchConfig, docScores map[int]float64, docMatches map[int][]Match) {
+	// A document's field postings are adjacent
+	for start := 0; start < len(postings); {
+		docID := postings[start].DocumentID
+		end := start
+		frequencies := make([]float64, 0, len(searchFields))
+		tf := 0.0
+		for ; end < len(postings) && postings[end].DocumentID == docID; end++ {
+			frequency := se.weightedFrequency(postings[end], config)
+			frequencies = append(frequencies, frequency)
+			tf += frequency
+		}
+
+		if tf > 0 {
+			score := weight * idf * tf * (config.K1 + 1) / (tf + config.K1)
+			docScores[docID] += score
+			for i, posting := range postings[start:end] {
+				if frequencies[i] == 0 {
+					continue
+				}
+				match := Match{
+					Field: posting.Field,
+					Text:  text,
+					Score: score * frequencies[i] / tf,
+				}
+				if spanWords > 0 && len(posting.Positions) > 0 {
+					match.firstWord = posting.Positions[0]
+					match.lastWord = posting.Positions[0] + spanWords - 1
+					match.hasSpan = true
+					match.phrase = true
+				}
+				docMatches[docID] = append(docMatches[docID], match)
+			}
+		}
+		start = end
+	}
+}
+
+// Field-boosted term frequency, normalized by the field's length relative to its average
+func (se *SearchEngine) weightedFrequency(posting DocumentIndex, config SearchConfig) float64 {
+	normalization := 1.0
+	if average := se.averageFieldLength(posting.Field); average > 0 {
+		length := float64(se.fieldLengths[uint(posting.DocumentID)][posting.Field])
+		normalization = 1 - config.B + config.B*length/average
+	}
+	return config.FieldBoosts[posting.Field] * float64(posting.Frequency) / normalization
+}
+
+func (se *SearchEngine) averageFieldLength(field string) float64 {
+	if len(se.documents) == 0 {
+		return 0
+	}
+	return float64(se.fieldTotals[field]) / float64(len(se.documents))
+}
+
+// Indexed terms within maxDistance edits of word, in sorted order
+func (se *SearchEngine) findFuzzyTerms(word string, maxDistance int) []string {
+	var terms []string
+
+	for indexWord := range se.Index {
+		if levenshteinDistance(word, indexWord) <= maxDistance {
+			terms = append(terms, indexWord)
+		}
+	}
+
+	sort.Strings(terms)
+	return terms
+}
+
+// Number of distinct documents in a list of postings
+func countDocuments(postings []DocumentIndex) int {
+	count := 0
+	for i := range postings {
+		if i == 0 || postings[i].DocumentID != postings[i-1].DocumentID {
+			count++
+		}
+	}
+	return count
+}
+
+// BM25 inverse document frequency, kept positive for terms found in most documents
+func (se *SearchEngine) inverseDocumentFrequency(term string) float64 {
+	return se.inverseDocumentFrequencyOf(se.Index[term])
+}
+
+// BM25 inverse document frequency of whatever the postings record, such as a phrase
+func (se *SearchEngine) inverseDocumentFrequencyOf(postings []DocumentIndex) float64 {
+	totalDocs := float64(len(se.documents))
+	docsWithTerm := float64(countDocuments(postings))
+
+	if docsWithTerm == 0 {
+		return 0
+	}
+
+	return math.Log(1 + (totalDocs-docsWithTerm+0.5)/(docsWithTerm+0.5))
+}
+
+func (se *SearchEngine) getDocumentByID(id uint) *PolicyFile {
+	if doc, exists := se.documents[id]; exists {
+		return &doc
+	}
+	return nil
+}
+
+func handleGetSearchIndexStats(c *gin.Context) {
+	c.JSON(http.StatusOK, getSearchEngine().Stats())
+}
+
+func handleRebuildSearchIndex(c *gin.Context) {
+	if err := documentSearch.Rebuild(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild search index"})
+		return
+	}
+	stats := documentSearch.Stats()
+
+	userID, _ := c.Get("user_id")
+	logSystemActivity(c, userID.(uint), ActionUpdate, fmt.Sprintf("Rebuilt search index (%d documents, %d terms in %dms)", stats.Documents, stats.Terms, stats.RebuildDurationMs))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Search index rebuilt", "stats": stats})
+}
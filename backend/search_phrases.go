@@ -0,0 +1,299 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Phrase queries and proximity scoring over the word positions in the search
+// index. Positions count every word of a field, stop words included, so a
+// phrase such as "report within 2 hours" only matches those words in order.
+
+// Free-text query split into its quoted phrases and remaining terms
+type searchQuery struct {
+	Terms   []string // Distinct normalized terms outside quotes
+	Phrases []searchPhrase
+}
+
+type searchPhrase struct {
+	Text  string   // The phrase as matched: lowercased words separated by spaces
+	Words []string // Lowercased words, stop words included
+}
+
+var quotedPhrasePattern = regexp.MustCompile(`"([^"]*)"`)
+
+func parseSearchQuery(query string) searchQuery {
+	var parsed searchQuery
+	seenTerms := make(map[string]bool)
+	addTerms := func(text string) {
+		for _, word := range tokenize(text) {
+			word = normalizeWord(word)
+			if !seenTerms[word] { // Repeating a word in the query doesn't make it more important
+				seenTerms[word] = true
+				parsed.Terms = append(parsed.Terms, word)
+			}
+		}
+	}
+
+	seenPhrases := make(map[string]bool)
+	for _, quoted := range quotedPhrasePattern.FindAllStringSubmatch(query, -1) {
+		var words []string
+		searchable := false
+		for _, token := range fieldTokens(quoted[1]) {
+			words = append(words, token.word)
+			searchable = searchable || isSearchableWord(token.word)
+		}
+
+		// A single quoted word, or one made only of stop words, is an ordinary term
+		if len(words) < 2 || !searchable {
+			addTerms(quoted[1])
+			continue
+		}
+
+		phrase := searchPhrase{Text: strings.Join(words, " "), Words: words}
+		if !seenPhrases[phrase.Text] {
+			seenPhrases[phrase.Text] = true
+			parsed.Phrases = append(parsed.Phrases, phrase)
+		}
+	}
+
+	// An unbalanced quote is just punctuation
+	addTerms(quotedPhrasePattern.ReplaceAllString(query, " "))
+	return parsed
+}
+
+// Document field a posting belongs to
+type postingKey struct {
+	DocumentID int
+	Field      string
+}
+
+// Occurrences of a phrase as postings: Frequency counts the occurrences in each
+// field and Positions holds the position of each occurrence's first word
+func (se *SearchEngine) findPhrase(phrase searchPhrase) []DocumentIndex {
+	// Indexed words pin the phrase down; the others are checked against the text
+	type anchor struct {
+		term   string
+		offset int
+	}
+	var anchors []anchor
+	for i, word := range phrase.Words {
+		if isSearchableWord(word) {
+			anchors = append(anchors, anchor{term: normalizeWord(word), offset: i})
+		}
+	}
+	if len(anchors) == 0 {
+		return nil
+	}
+	verify := len(anchors) < len(phrase.Words)
+
+	// Positions of the other anchors by document field
+	others := make([]map[postingKey]map[int]bool, len(anchors))
+	for i := 1; i < len(anchors); i++ {
+		others[i] = make(map[postingKey]map[int]bool)
+		for _, posting := range se.Index[anchors[i].term] {
+			positions := make(map[int]bool, len(posting.Positions))
+			for _, position := range posting.Positions {
+				positions[position] = true
+			}
+			others[i][postingKey{posting.DocumentID, posting.Field}] = positions
+		}
+	}
+
+	var postings []DocumentIndex
+	for _, posting := range se.Index[anchors[0].term] {
+		key := postingKey{posting.DocumentID, posting.Field}
+		var tokens []fieldToken
+		var starts []int
+
+	positions:
+		for _, position := range posting.Positions {
+			start := position - anchors[0].offset
+			if start < 0 {
+				continue
+			}
+			for i := 1; i < len(anchors); i++ {
+				if !others[i][key][start+anchors[i].offset] {
+					continue positions
+				}
+			}
+			if verify {
+				if tokens == nil {
+					tokens = fieldTokens(documentFieldText(se.documents[uint(posting.DocumentID)], posting.Field))
+				}
+				if !phraseAt(tokens, start, phrase.Words) {
+					continue
+				}
+			}
+			starts = append(starts, start)
+		}
+
+		if len(starts) > 0 {
+			postings = append(postings, DocumentIndex{
+				DocumentID: posting.DocumentID,
+				Field:      posting.Field,
+				Frequency:  len(starts),
+				Positions:  starts,
+			})
+		}
+	}
+	return postings
+}
+
+// Whether the words that aren't indexed appear at their place in a phrase
+// starting at the given position; the indexed words were matched already
+func phraseAt(tokens []fieldToken, start int, words []string) bool {
+	if start+len(words) > len(tokens) {
+		return false
+	}
+	for i, word := range words {
+		if !isSearchableWord(word) && tokens[start+i].word != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Reward documents where several query terms appear close together. Each
+// document earns the bonus of its best field: the tightest group of words
+// holding all the query terms found in that field, scored by their combined
+// IDF and shrinking with every unrelated word inside the group.
+func (se *SearchEngine) scoreProximity(terms []string, exact map[string]bool, config SearchConfig, docScores map[int]float64, docMatches map[int][]Match) {
+	if config.ProximityWeight == 0 || config.ProximityWindow < 2 {
+		return
+	}
+
+	var matched []string
+	var idfs []float64
+	for _, term := range terms {
+		if exact[term] {
+			matched = append(matched, term)
+			idfs = append(idfs, se.inverseDocumentFrequency(term))
+		}
+	}
+	if len(matched) < 2 {
+		return
+	}
+
+	// Positions of the matched terms by document field
+	occurrences := make(map[postingKey][]termOccurrence)
+	for i, term := range matched {
+		for _, posting := range se.Index[term] {
+			key := postingKey{posting.DocumentID, posting.Field}
+			for _, position := range posting.Positions {
+				occurrences[key] = append(occurrences[key], termOccurrence{position: position, term: i})
+			}
+		}
+	}
+
+	best := make(map[int]Match)
+	for key, list := range occurrences {
+		first, last, present := tightestWindow(list, len(matched))
+		if len(present) < 2 || last-first+1 > config.ProximityWindow {
+			continue
+		}
+
+		idf := 0.0
+		var words []string
+		for _, i := range present {
+			idf += idfs[i]
+			words = append(words, matched[i])
+		}
+		slack := last - first + 1 - len(present) // Unrelated words inside the group
+		bonus := config.ProximityWeight * idf / float64(1+slack)
+
+		current, exists := best[key.DocumentID]
+		if !exists || bonus > current.Score || (bonus == current.Score && key.Field < current.Field) {
+			best[key.DocumentID] = Match{
+				Field:     key.Field,
+				Text:      strings.Join(words, " "),
+				Score:     bonus,
+				firstWord: first,
+				lastWord:  last,
+				hasSpan:   true,
+			}
+		}
+	}
+
+	for docID, match := range best {
+		docScores[docID] += match.Score
+		docMatches[docID] = append(docMatches[docID], match)
+	}
+}
+
+// A query term at a word position of a field
+type termOccurrence struct {
+	position int
+	term     int // Index of the term in the query
+}
+
+// Shortest run of positions containing every distinct term of the occurrences,
+// returned with the indexes of those terms in query order
+func tightestWindow(occurrences []termOccurrence, terms int) (first, last int, present []int) {
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].position < occurrences[j].position
+	})
+
+	counts := make([]int, terms)
+	for _, occurrence := range occurrences {
+		if counts[occurrence.term] == 0 {
+			present = append(present, occurrence.term)
+		}
+		counts[occurrence.term]++
+	}
+	sort.Ints(present)
+	for i := range counts {
+		counts[i] = 0
+	}
+
+	first, last = -1, -1
+	covered, left := 0, 0
+	for _, occurrence := range occurrences {
+		if counts[occurrence.term] == 0 {
+			covered++
+		}
+		counts[occurrence.term]++
+
+		for covered == len(present) {
+			start, end := occurrences[left].position, occurrence.position
+			if first < 0 || end-start < last-first {
+				first, last = start, end
+			}
+			counts[occurrences[left].term]--
+			if counts[occurrences[left].term] == 0 {
+				covered--
+			}
+			left++
+		}
+	}
+	return first, last, present
+}
+
+// Turn the word positions of phrase and proximity matches into character offsets
+func resolveMatchSpans(result *DocumentMatch) {
+	tokens := make(map[string][]fieldToken)
+	for i := range result.Matches {
+		match := &result.Matches[i]
+		if !match.hasSpan {
+			continue
+		}
+
+		text := documentFieldText(result.Document, match.Field)
+		if _, exists := tokens[match.Field]; !exists {
+			tokens[match.Field] = fieldTokens(text)
+		}
+		words := tokens[match.Field]
+		if match.firstWord < 0 || match.lastWord >= len(words) {
+			continue
+		}
+
+		start, end := words[match.firstWord].start, words[match.lastWord].end
+		match.Span = &MatchSpan{
+			Start: utf8.RuneCountInString(text[:start]),
+			End:   utf8.RuneCountInString(text[:end]),
+			Text:  text[start:end],
+		}
+	}
+}
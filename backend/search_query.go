@@ -0,0 +1,684 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Structured document search queries, for example
+//
+//	vpn AND (remote OR travel) NOT draft
+//	tag:vpn name:password category:"Remote Work"
+//	secur* updated:>=2024-01-01
+//
+// Words next to each other must all match, OR matches either side and NOT
+// (or a leading -) excludes documents. Field scopes restrict a word, phrase
+// or group to one field; a trailing * matches every word with that prefix.
+// Matching documents are ranked with the same BM25F scoring as free text.
+
+// Fields a word or phrase can be scoped to, by the name used in queries
+var queryFields = map[string]string{
+	"name":        "name",
+	"title":       "name",
+	"description": "description",
+	"content":     "content",
+	"category":    "category",
+	"tag":         "tags",
+	"tags":        "tags",
+}
+
+// Filters that don't search the index
+const (
+	queryFilterType    = "type"
+	queryFilterUpdated = "updated"
+)
+
+const (
+	queryDateFormat   = "2006-01-02"
+	maxPrefixExpanded = 100 // Index words a single prefix wildcard may stand for
+)
+
+// Parse error reported to the caller, with the byte offset of the problem
+type searchQueryError struct {
+	Position int
+	Message  string
+}
+
+func (e *searchQueryError) Error() string {
+	return e.Message
+}
+
+func queryErrorf(position int, format string, args ...interface{}) error {
+	return &searchQueryError{Position: position, Message: fmt.Sprintf(format, args...)}
+}
+
+// Lexical tokens of a query
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryPhrase
+	queryOpen
+	queryClose
+	queryAnd
+	queryOr
+	queryNot
+	queryEnd
+)
+
+type queryToken struct {
+	kind     queryTokenKind
+	text     string
+	position int
+}
+
+func lexSearchQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryOpen, text: "(", position: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryClose, text: ")", position: i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, queryErrorf(i, "Unterminated quoted phrase")
+			}
+			tokens = append(tokens, queryToken{kind: queryPhrase, text: query[i+1 : i+1+end], position: i})
+			i += end + 2
+		case c == '-':
+			// A leading dash negates the term that follows it; on its own it is punctuation
+			if i+1 < len(query) && !strings.ContainsRune(" \t\n\r)", rune(query[i+1])) {
+				tokens = append(tokens, queryToken{kind: queryNot, text: "-", position: i})
+			}
+			i++
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r()\"", rune(query[i])) {
+				i++
+			}
+			token := queryToken{kind: queryWord, text: query[start:i], position: start}
+			switch token.text {
+			case "AND":
+				token.kind = queryAnd
+			case "OR":
+				token.kind = queryOr
+			case "NOT":
+				token.kind = queryNot
+			}
+			tokens = append(tokens, token)
+		}
+	}
+	return append(tokens, queryToken{kind: queryEnd, position: len(query)}), nil
+}
+
+// Recursive descent parser over the query tokens:
+//
+//	or      = and { "OR" and }
+//	and     = unary { ["AND"] unary }
+//	unary   = ("NOT" | "-") unary | primary
+//	primary = "(" or ")" | [field ":"] (word | phrase | "(" or ")")
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+// Parse a structured query; clauses made only of stop words are dropped
+func parseStructuredQuery(query string) (queryNode, error) {
+	tokens, err := lexSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &queryParser{tokens: tokens}
+	node, err := parser.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != queryEnd {
+		if token.kind == queryClose {
+			return nil, queryErrorf(token.position, "Unexpected closing parenthesis")
+		}
+		return nil, queryErrorf(token.position, "Unexpected %q", token.text)
+	}
+	if node == nil {
+		return nil, queryErrorf(0, "Search query has no searchable words")
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) advance() queryToken {
+	token := p.tokens[p.next]
+	if token.kind != queryEnd {
+		p.next++
+	}
+	return token
+}
+
+func (p *queryParser) parseOr(field string) (queryNode, error) {
+	left, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+
+	children := []queryNode{left}
+	for p.peek().kind == queryOr {
+		p.advance()
+		right, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	return newOrNode(children), nil
+}
+
+func (p *queryParser) parseAnd(field string) (queryNode, error) {
+	left, err := p.parseUnary(field)
+	if err != nil {
+		return nil, err
+	}
+
+	children := []queryNode{left}
+	for {
+		switch p.peek().kind {
+		case queryAnd:
+			p.advance()
+		case queryWord, queryPhrase, queryOpen, queryNot:
+			// Terms next to each other must all match
+		default:
+			return newAndNode(children), nil
+		}
+
+		right, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+}
+
+func (p *queryParser) parseUnary(field string) (queryNode, error) {
+	if p.peek().kind == queryNot {
+		p.advance()
+		child, err := p.parseUnary(field)
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *queryParser) parsePrimary(field string) (queryNode, error) {
+	token := p.advance()
+	switch token.kind {
+	case queryOpen:
+		return p.parseGroup(token, field)
+	case queryPhrase:
+		return newTextNode(field, token.text), nil
+	case queryWord:
+		return p.parseWord(token, field)
+	case queryClose:
+		return nil, queryErrorf(token.position, "Unexpected closing parenthesis")
+	case queryAnd, queryOr:
+		return nil, queryErrorf(token.position, "Expected a search term before %s", token.text)
+	default:
+		return nil, queryErrorf(token.position, "Expected a search term at the end of the query")
+	}
+}
+
+func (p *queryParser) parseGroup(open queryToken, field string) (queryNode, error) {
+	node, err := p.parseOr(field)
+	if err != nil {
+		return nil, err
+	}
+	if p.advance().kind != queryClose {
+		return nil, queryErrorf(open.position, "Missing closing parenthesis for this group")
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseWord(token queryToken, field string) (queryNode, error) {
+	name, value, scoped := strings.Cut(token.text, ":")
+	if !scoped || !isFieldName(name) || strings.HasPrefix(value, "//") {
+		// Times such as 10:30 and URLs keep their colons as plain text
+		return newWordNode(field, token.text, token.position)
+	}
+
+	name = strings.ToLower(name)
+	if field != "" {
+		return nil, queryErrorf(token.position, "Field %q can't be used inside another field scope", name)
+	}
+	valuePosition := token.position + len(name) + 1
+
+	switch name {
+	case queryFilterType:
+		if value == "" {
+			return nil, queryErrorf(valuePosition, "Expected a document type after type:")
+		}
+		return &typeNode{documentType: value}, nil
+	case queryFilterUpdated:
+		return parseDateFilter(value, valuePosition)
+	}
+
+	scope, known := queryFields[name]
+	if !known {
+		return nil, queryErrorf(token.position, "Unknown search field %q; use name, description, content, category, tag, type or updated", name)
+	}
+	if value != "" {
+		return newWordNode(scope, value, valuePosition)
+	}
+
+	// The value is a quoted phrase or a group: category:"Remote Work", tag:(vpn OR wifi)
+	if next := p.peek(); next.position == valuePosition {
+		switch next.kind {
+		case queryPhrase:
+			p.advance()
+			return newTextNode(scope, next.text), nil
+		case queryOpen:
+			p.advance()
+			return p.parseGroup(next, scope)
+		}
+	}
+	return nil, queryErrorf(valuePosition, "Expected a word, quoted phrase or group after %s:", name)
+}
+
+// Whether text before a colon names a field rather than being part of a word
+func isFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// A bare word: a prefix wildcard, a single term, or a phrase when punctuation splits it (e-mail)
+func newWordNode(field, word string, position int) (queryNode, error) {
+	if !strings.Contains(word, "*") {
+		return newTextNode(field, word), nil
+	}
+
+	prefix := strings.ToLower(strings.TrimSuffix(word, "*"))
+	tokens := fieldTokens(prefix)
+	if strings.Contains(prefix, "*") || len(tokens) != 1 || tokens[0].word != prefix {
+		return nil, queryErrorf(position, "Only a single trailing * is supported, as in secur*")
+	}
+	if len(prefix) < 2 {
+		return nil, queryErrorf(position, "Wildcards need at least 2 characters before the *")
+	}
+	// Index words are stemmed, so "reporting*" has to look for "report"
+	return &prefixNode{field: field, prefix: normalizeWord(prefix)}, nil
+}
+
+// Words or a quoted phrase: a term for one searchable word, a phrase for more
+func newTextNode(field, text string) queryNode {
+	var words []string
+	var searchable []string
+	for _, token := range fieldTokens(text) {
+		words = append(words, token.word)
+		if isSearchableWord(token.word) {
+			searchable = append(searchable, token.word)
+		}
+	}
+
+	switch {
+	case len(searchable) == 0:
+		return nil
+	case len(words) == 1:
+		return &termNode{field: field, term: normalizeWord(words[0])}
+	default:
+		return &phraseNode{field: field, phrase: searchPhrase{Text: strings.Join(words, " "), Words: words}}
+	}
+}
+
+// Date filter on UpdatedAt: a day, a comparison (>, >=, <, <=) or a range (from..to, either end optional)
+func parseDateFilter(value string, position int) (queryNode, error) {
+	parse := func(text string) (time.Time, error) {
+		date, err := time.Parse(queryDateFormat, text)
+		if err != nil {
+			return time.Time{}, queryErrorf(position, "Invalid date %q for updated:, use YYYY-MM-DD", text)
+		}
+		return date, nil
+	}
+	const day = 24 * time.Hour
+
+	if from, to, isRange := strings.Cut(value, ".."); isRange {
+		node := &dateNode{}
+		if from == "" && to == "" {
+			return nil, queryErrorf(position, "Expected a date on at least one side of .. for updated:")
+		}
+		if from != "" {
+			date, err := parse(from)
+			if err != nil {
+				return nil, err
+			}
+			node.from = date
+		}
+		if to != "" {
+			date, err := parse(to)
+			if err != nil {
+				return nil, err
+			}
+			node.to = date.Add(day)
+		}
+		return node, nil
+	}
+
+	for _, operator := range []string{">=", "<=", ">", "<"} {
+		if !strings.HasPrefix(value, operator) {
+			continue
+		}
+		date, err := parse(strings.TrimPrefix(value, operator))
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case ">=":
+			return &dateNode{from: date}, nil
+		case ">":
+			return &dateNode{from: date.Add(day)}, nil
+		case "<":
+			return &dateNode{to: date}, nil
+		default:
+			return &dateNode{to: date.Add(day)}, nil
+		}
+	}
+
+	if value == "" {
+		return nil, queryErrorf(position, "Expected a date after updated:")
+	}
+	date, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &dateNode{from: date, to: date.Add(day)}, nil
+}
+
+// Documents matched by part of a query, with their scores and matches so far
+type queryHits struct {
+	scores  map[int]float64
+	matches map[int][]Match
+}
+
+func newQueryHits() queryHits {
+	return queryHits{scores: make(map[int]float64), matches: make(map[int][]Match)}
+}
+
+// Node of a parsed query, evaluated against the index under its read lock
+type queryNode interface {
+	evaluate(se *SearchEngine, config SearchConfig) queryHits
+}
+
+type termNode struct {
+	field string // Empty for every field
+	term  string // Normalized
+}
+
+type prefixNode struct {
+	field  string
+	prefix string // Normalized
+}
+
+type phraseNode struct {
+	field  string
+	phrase searchPhrase
+}
+
+type dateNode struct {
+	from, to time.Time // UpdatedAt in [from, to); zero for an open end
+}
+
+type typeNode struct {
+	documentType string
+}
+
+// Exact category, used for the category parameter of the search endpoint
+type categoryNode struct {
+	category string
+}
+
+type andNode struct {
+	children []queryNode
+}
+
+type orNode struct {
+	children []queryNode
+}
+
+type notNode struct {
+	child queryNode
+}
+
+// Combine clauses, leaving out those that had no searchable words
+func newAndNode(children []queryNode) queryNode {
+	if kept := withoutEmpty(children); len(kept) > 1 {
+		return &andNode{children: kept}
+	} else if len(kept) == 1 {
+		return kept[0]
+	}
+	return nil
+}
+
+func newOrNode(children []queryNode) queryNode {
+	if kept := withoutEmpty(children); len(kept) > 1 {
+		return &orNode{children: kept}
+	} else if len(kept) == 1 {
+		return kept[0]
+	}
+	return nil
+}
+
+func withoutEmpty(nodes []queryNode) []queryNode {
+	var kept []queryNode
+	for _, node := range nodes {
+		if node != nil {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
+// Postings restricted to one field, or all of them when field is empty
+func fieldPostings(postings []DocumentIndex, field string) []DocumentIndex {
+	if field == "" {
+		return postings
+	}
+	var scoped []DocumentIndex
+	for _, posting := range postings {
+		if posting.Field == field {
+			scoped = append(scoped, posting)
+		}
+	}
+	return scoped
+}
+
+func (n *termNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := newQueryHits()
+
+	// Try exact match first
+	if postings := fieldPostings(se.Index[n.term], n.field); len(postings) > 0 {
+		se.scorePostings(postings, n.term, 0, se.inverseDocumentFrequency(n.term), 1, config, hits.scores, hits.matches)
+		return hits
+	}
+
+	// If no exact matches, try fuzzy matching
+	for _, term := range se.findFuzzyTerms(n.term, 2) { // max 2 edits
+		postings := fieldPostings(se.Index[term], n.field)
+		se.scorePostings(postings, term, 0, se.inverseDocumentFrequency(term), fuzzyTermWeight, config, hits.scores, hits.matches)
+	}
+	return hits
+}
+
+func (n *prefixNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	var terms []string
+	for term := range se.Index {
+		if strings.HasPrefix(term, n.prefix) {
+			terms = append(terms, term)
+		}
+	}
+
+	// Very short prefixes keep their most widespread words
+	sort.Slice(terms, func(i, j int) bool {
+		if len(se.Index[terms[i]]) != len(se.Index[terms[j]]) {
+			return len(se.Index[terms[i]]) > len(se.Index[terms[j]])
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > maxPrefixExpanded {
+		terms = terms[:maxPrefixExpanded]
+	}
+
+	hits := newQueryHits()
+	for _, term := range terms {
+		postings := fieldPostings(se.Index[term], n.field)
+		se.scorePostings(postings, term, 0, se.inverseDocumentFrequency(term), 1, config, hits.scores, hits.matches)
+	}
+	return hits
+}
+
+func (n *phraseNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := newQueryHits()
+	postings := se.findPhrase(n.phrase)
+	se.scorePostings(fieldPostings(postings, n.field), n.phrase.Text, len(n.phrase.Words), se.inverseDocumentFrequencyOf(postings), 1, config, hits.scores, hits.matches)
+	return hits
+}
+
+func (n *dateNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := newQueryHits()
+	for id, doc := range se.documents {
+		if (n.from.IsZero() || !doc.UpdatedAt.Before(n.from)) && (n.to.IsZero() || doc.UpdatedAt.Before(n.to)) {
+			hits.scores[int(id)] = 0
+		}
+	}
+	return hits
+}
+
+func (n *typeNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := newQueryHits()
+	for id, doc := range se.documents {
+		if strings.EqualFold(doc.DocumentType, n.documentType) {
+			hits.scores[int(id)] = 0
+		}
+	}
+	return hits
+}
+
+func (n *categoryNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := newQueryHits()
+	for id, doc := range se.documents {
+		if strings.EqualFold(doc.Category, n.category) {
+			hits.scores[int(id)] = 0
+		}
+	}
+	return hits
+}
+
+func (n *andNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := n.children[0].evaluate(se, config)
+	for _, child := range n.children[1:] {
+		other := child.evaluate(se, config)
+		for docID, score := range hits.scores {
+			otherScore, exists := other.scores[docID]
+			if !exists {
+				delete(hits.scores, docID)
+				delete(hits.matches, docID)
+				continue
+			}
+			hits.scores[docID] = score + otherScore
+			hits.matches[docID] = append(hits.matches[docID], other.matches[docID]...)
+		}
+	}
+	return hits
+}
+
+func (n *orNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	hits := newQueryHits()
+	for _, child := range n.children {
+		other := child.evaluate(se, config)
+		for docID, score := range other.scores {
+			hits.scores[docID] += score
+			hits.matches[docID] = append(hits.matches[docID], other.matches[docID]...)
+		}
+	}
+	return hits
+}
+
+func (n *notNode) evaluate(se *SearchEngine, config SearchConfig) queryHits {
+	excluded := n.child.evaluate(se, config)
+	hits := newQueryHits()
+	for id := range se.documents {
+		if _, exists := excluded.scores[int(id)]; !exists {
+			hits.scores[int(id)] = 0
+		}
+	}
+	return hits
+}
+
+// Words searched across every field outside NOT, for proximity scoring
+func proximityTerms(node queryNode, terms *[]string) {
+	switch n := node.(type) {
+	case *termNode:
+		if n.field == "" {
+			*terms = append(*terms, n.term)
+		}
+	case *andNode:
+		for _, child := range n.children {
+			proximityTerms(child, terms)
+		}
+	case *orNode:
+		for _, child := range n.children {
+			proximityTerms(child, terms)
+		}
+	}
+}
+
+// Run a parsed query, ranking the matching documents like free-text search
+func (se *SearchEngine) Query(node queryNode, limit int) []DocumentMatch {
+	if limit == 0 {
+		limit = 10
+	}
+	config := loadSearchConfig()
+
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+
+	hits := node.evaluate(se, config)
+
+	// Documents where the query words appear close together rank higher
+	var terms []string
+	proximityTerms(node, &terms)
+	exact := make(map[string]bool)
+	var distinct []string
+	for _, term := range terms {
+		if !exact[term] && len(se.Index[term]) > 0 {
+			exact[term] = true
+			distinct = append(distinct, term)
+		}
+	}
+	proximity := newQueryHits()
+	se.scoreProximity(distinct, exact, config, proximity.scores, proximity.matches)
+	for docID, bonus := range proximity.scores {
+		if _, matched := hits.scores[docID]; matched {
+			hits.scores[docID] += bonus
+			hits.matches[docID] = append(hits.matches[docID], proximity.matches[docID]...)
+		}
+	}
+
+	return se.rankResults(hits.scores, hits.matches, limit, config)
+}
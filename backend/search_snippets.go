@@ -0,0 +1,280 @@
+package main
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Search result snippets: an excerpt of the content and description around the
+// densest group of matched words, with those words wrapped in highlight markers.
+// Offsets are in characters of the field text so the frontend can jump to the
+// passage. With HTML markers (the default <mark>) the document text is escaped.
+
+// Fields excerpts are taken from, in the order they are returned
+var snippetFields = []string{"content", "description"}
+
+// Byte range of highlighted text within a field
+type textRange struct {
+	start, end int
+}
+
+// Excerpts for a result: one per field with highlighted words, or the opening
+// of the content when the document only matched on its name, category or tags
+func buildSnippets(result DocumentMatch, config SearchConfig) []SearchSnippet {
+	if config.SnippetLength <= 0 {
+		return nil
+	}
+
+	var snippets []SearchSnippet
+	for _, field := range snippetFields {
+		text := documentFieldText(result.Document, field)
+		terms, phrases := highlightTerms(result.Matches, field)
+		ranges := highlightRanges(text, terms, phrases)
+		if len(ranges) > 0 {
+			snippets = append(snippets, makeSnippet(field, text, ranges, config))
+		}
+	}
+
+	if len(snippets) == 0 && strings.TrimSpace(result.Document.Content) != "" {
+		snippets = append(snippets, makeSnippet("content", result.Document.Content, nil, config))
+	}
+	return snippets
+}
+
+// Words and phrases to highlight in a field: every term that matched there,
+// and phrase matches as a whole. Terms are normalized the way the index is.
+func highlightTerms(matches []Match, field string) (map[string]bool, [][]string) {
+	terms := make(map[string]bool)
+	var phrases [][]string
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if match.Field != field {
+			continue
+		}
+		if !match.phrase {
+			for _, term := range strings.Fields(match.Text) {
+				terms[term] = true
+			}
+			continue
+		}
+		if !seen[match.Text] {
+			seen[match.Text] = true
+			phrases = append(phrases, strings.Fields(match.Text))
+		}
+	}
+	return terms, phrases
+}
+
+// Sorted, merged byte ranges of the highlighted words and phrases in text
+func highlightRanges(text string, terms map[string]bool, phrases [][]string) []textRange {
+	tokens := fieldTokens(text)
+
+	var ranges []textRange
+	for _, token := range tokens {
+		if isSearchableWord(token.word) && terms[normalizeWord(token.word)] {
+			ranges = append(ranges, textRange{token.start, token.end})
+		}
+	}
+	for _, words := range phrases {
+		for start := range tokens {
+			if phraseMatchesAt(tokens, start, words) {
+				ranges = append(ranges, textRange{tokens[start].start, tokens[start+len(words)-1].end})
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.end {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Whether a phrase occurs at a word position, comparing indexed words by their
+// normalized form and stop words exactly
+func phraseMatchesAt(tokens []fieldToken, start int, words []string) bool {
+	if start+len(words) > len(tokens) {
+		return false
+	}
+	for i, word := range words {
+		token := tokens[start+i].word
+		if isSearchableWord(word) {
+			if normalizeWord(token) != normalizeWord(word) {
+				return false
+			}
+		} else if token != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Excerpt of about SnippetLength characters centered on the group of highlights
+// that fits the most of them into one excerpt
+func makeSnippet(field, text string, ranges []textRange, config SearchConfig) SearchSnippet {
+	length := config.SnippetLength
+	start, end := 0, len(text)
+
+	if total := utf8.RuneCountInString(text); total > length {
+		// The length counts characters, so the window is placed in rune offsets
+		starts, ends := make([]int, len(ranges)), make([]int, len(ranges))
+		offset, runes := 0, 0
+		for i, r := range ranges {
+			runes += utf8.RuneCountInString(text[offset:r.start])
+			starts[i] = runes
+			runes += utf8.RuneCountInString(text[r.start:r.end])
+			ends[i] = runes
+			offset = r.end
+		}
+
+		// Densest group: the most highlights starting within one excerpt length
+		first, last := 0, 0
+		for i := range ranges {
+			j := i
+			for j+1 < len(ranges) && ends[j+1]-starts[i] <= length {
+				j++
+			}
+			if j-i > last-first {
+				first, last = i, j
+			}
+		}
+
+		center := 0
+		if len(ranges) > 0 {
+			center = (starts[first] + ends[last]) / 2
+		}
+		window := center - length/2
+		if window > total-length {
+			window = total - length
+		}
+		if window < 0 {
+			window = 0
+		}
+		start = runeByteOffset(text, window)
+		end = start + runeByteOffset(text[start:], length)
+
+		// Don't cut words in half at either end
+		for start > 0 && start < end && isWordRuneBefore(text, start) && isWordRuneAt(text, start) {
+			_, size := utf8.DecodeRuneInString(text[start:])
+			start += size
+		}
+		for end < len(text) && end > start && isWordRuneBefore(text, end) && isWordRuneAt(text, end) {
+			_, size := utf8.DecodeLastRuneInString(text[:end])
+			end -= size
+		}
+	}
+
+	// Leave out surrounding whitespace
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		end -= size
+	}
+
+	escape := strings.HasPrefix(config.HighlightPre, "<")
+	piece := func(s string) string {
+		s = collapseSpaces(s)
+		if escape {
+			return html.EscapeString(s)
+		}
+		return s
+	}
+
+	snippet := SearchSnippet{
+		Field:      field,
+		Start:      utf8.RuneCountInString(text[:start]),
+		End:        utf8.RuneCountInString(text[:end]),
+		Highlights: []SnippetRange{},
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	position := start
+	for _, r := range ranges {
+		if r.start < start || r.end > end {
+			continue // Outside the excerpt
+		}
+		b.WriteString(piece(text[position:r.start]))
+		b.WriteString(config.HighlightPre)
+		b.WriteString(piece(text[r.start:r.end]))
+		b.WriteString(config.HighlightPost)
+		position = r.end
+
+		snippet.Highlights = append(snippet.Highlights, SnippetRange{
+			Start: utf8.RuneCountInString(text[:r.start]),
+			End:   utf8.RuneCountInString(text[:r.end]),
+		})
+	}
+	b.WriteString(piece(text[position:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	snippet.Text = b.String()
+	return snippet
+}
+
+// Byte offset of the character at a rune offset, or the text length past its end
+func runeByteOffset(text string, runes int) int {
+	for i := range text {
+		if runes == 0 {
+			return i
+		}
+		runes--
+	}
+	return len(text)
+}
+
+func isWordRuneAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+func isWordRuneBefore(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Replace each run of whitespace, line breaks included, with a single space
+func collapseSpaces(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
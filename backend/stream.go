@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Server-Sent Event names emitted by the streaming chat endpoint
+const (
+	EventToken       = "token"        // Incremental piece of the answer
+	EventPolicyFiles = "policy_files" // Documents matched for the question
+	EventDone        = "done"         // Final response with sources and citations
+	EventError       = "error"
+)
+
+// Payload of a token event
+type StreamToken struct {
+	Content string `json:"content"`
+}
+
+// Write a single Server-Sent Event and flush it to the client
+func writeSSE(c *gin.Context, event string, data interface{}) error {
+	if err := c.Request.Context().Err(); err != nil {
+		return err
+	}
+	c.SSEvent(event, data)
+	c.Writer.Flush()
+	return nil
+}
+
+// Streaming chat handler relaying the LLM output as Server-Sent Events
+func handleChatStream(c *gin.Context) {
+	var req ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !guardChatRequest(c, &req) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	conversation, history, err := loadChatConversation(userID.(uint), req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load conversation"})
+		}
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	var streamErr error
+
+	intent := classifyChatTurn(ctx, userID.(uint), req, history)
+
+	user := currentUser(c)
+	response, answered := intentResponse(c, user, conversation.ID, intent.Intent, req.Message, history)
+	if answered {
+		streamErr = writeSSE(c, EventToken, StreamToken{Content: response.Response})
+	} else {
+		grounded := prepareGroundedChat(user, req.Message, history)
+		logGuardrailFindings(c, grounded.Findings)
+
+		cacheKey, cacheable := chatCacheKey(user, req.Message, history, grounded)
+		llmResponse, cached := (*LLMResponse)(nil), false
+		if cacheable {
+			llmResponse, cached = cachedChatAnswer(cacheKey)
+		}
+
+		if cached {
+			streamErr = writeSSE(c, EventToken, StreamToken{Content: llmResponse.Text})
+		} else {
+			var err error
+			llmResponse, err = streamLLM(ctx, grounded.Request, func(token string) error {
+				return writeSSE(c, EventToken, StreamToken{Content: token})
+			})
+			streamErr = err
+
+			// Partial answers still consumed tokens
+			recordLLMUsage(userID.(uint), grounded.Request, llmResponse)
+			if cacheable && err == nil {
+				storeChatAnswer(cacheKey, user, llmResponse)
+			}
+		}
+
+		response = ChatResponse{
+			Type:           "onboarding",
+			Cached:         cached,
+			PromptTemplate: grounded.Template,
+			PolicyFiles:    grounded.PolicyFiles,
+			Sources:        passagesToSources(grounded.Passages),
+		}
+		if llmResponse != nil {
+			response.Response = llmResponse.Text
+			response.Provider = llmResponse.Provider
+			response.Model = llmResponse.Model
+			response.Citations = buildCitations(llmResponse.Text, grounded.Passages)
+		}
+	}
+	response.Intent = intent.Intent
+	response.IntentConfidence = intent.Confidence
+
+	response.Citations = validateCitations(response.Citations, response.Sources)
+
+	// Keep whatever was generated, even if the client went away
+	response.ConversationID = conversation.ID
+	if response.Response != "" {
+		if message, err := saveChatExchange(conversation, req, response); err != nil {
+			log.Printf("Failed to save chat messages for conversation %d: %v", conversation.ID, err)
+		} else {
+			response.MessageID = message.ID
+		}
+	}
+
+	cancelled := ctx.Err() != nil
+	if streamErr != nil && !cancelled {
+		log.Printf("Chat stream failed: %v", streamErr)
+		writeSSE(c, EventError, gin.H{"error": "Failed to generate response"})
+	}
+
+	if !cancelled {
+		policyFiles := response.PolicyFiles
+		if policyFiles == nil {
+			policyFiles = []PolicyFile{}
+		}
+		writeSSE(c, EventPolicyFiles, policyFiles)
+		writeSSE(c, EventDone, response)
+	}
+
+	// Audit the exchange even if the client disconnected mid-stream
+	note := ""
+	if cancelled {
+		note = " (cancelled by client)"
+	}
+	logChatActivity(c, req, response, note)
+}
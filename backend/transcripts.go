@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ConversationTranscript is an exported copy of a conversation for managers and auditors
+type ConversationTranscript struct {
+	ConversationID uint                 `json:"conversation_id"`
+	Title          string               `json:"title"`
+	Owner          UserInfo             `json:"owner"`
+	StartedAt      time.Time            `json:"started_at"`
+	LastActivityAt time.Time            `json:"last_activity_at"`
+	ExportedAt     time.Time            `json:"exported_at"`
+	ExportedBy     string               `json:"exported_by"`
+	Messages       []ChatMessage        `json:"messages"`
+	Documents      []TranscriptDocument `json:"documents"` // Every document cited in the conversation
+}
+
+// TranscriptDocument is a document cited by the assistant
+type TranscriptDocument struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	Category       string `json:"category,omitempty"`
+	CurrentVersion int    `json:"current_version,omitempty"` // Version at export time, 0 if the document was deleted
+	Citations      int    `json:"citations"`
+}
+
+// Transcript export formats
+const (
+	TranscriptMarkdown = "markdown"
+	TranscriptJSON     = "json"
+	TranscriptPDF      = "pdf"
+)
+
+const transcriptTimeFormat = "2006-01-02 15:04:05 MST"
+
+// Users who may export any user's transcript
+func canExportAnyTranscript(c *gin.Context) bool {
+	role, _ := c.Get("user_role")
+	return role == RoleAdmin || role == RoleITSecurity
+}
+
+func transcriptFormat(format string) (string, bool) {
+	switch strings.ToLower(format) {
+	case "", "md", TranscriptMarkdown:
+		return TranscriptMarkdown, true
+	case TranscriptJSON:
+		return TranscriptJSON, true
+	case TranscriptPDF:
+		return TranscriptPDF, true
+	}
+	return "", false
+}
+
+// Build the transcript of a conversation with its owner and cited documents
+func buildTranscript(conversation Conversation, exportedBy string) (ConversationTranscript, error) {
+	var owner User
+	if err := db.First(&owner, conversation.UserID).Error; err != nil {
+		return ConversationTranscript{}, err
+	}
+
+	counts := make(map[uint]int)
+	names := make(map[uint]string)
+	for _, message := range conversation.Messages {
+		for _, citation := range message.Citations {
+			counts[citation.DocumentID]++
+			names[citation.DocumentID] = citation.DocumentName
+		}
+	}
+
+	ids := make([]uint, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	current := make(map[uint]PolicyFile)
+	if len(ids) > 0 {
+		var documents []PolicyFile
+		if err := db.Select("id", "name", "category", "version").Where("id IN ?", ids).Find(&documents).Error; err != nil {
+			return ConversationTranscript{}, err
+		}
+		for _, document := range documents {
+			current[document.ID] = document
+		}
+	}
+
+	documents := make([]TranscriptDocument, 0, len(ids))
+	for _, id := range ids {
+		document := TranscriptDocument{ID: id, Name: names[id], Citations: counts[id]}
+		if found, exists := current[id]; exists {
+			document.Name = found.Name
+			document.Category = found.Category
+			document.CurrentVersion = found.Version
+		}
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].Name < documents[j].Name })
+
+	messages := conversation.Messages
+	if messages == nil {
+		messages = []ChatMessage{}
+	}
+	return ConversationTranscript{
+		ConversationID: conversation.ID,
+		Title:          conversation.Title,
+		Owner:          userToUserInfo(owner),
+		StartedAt:      conversation.CreatedAt,
+		LastActivityAt: conversation.UpdatedAt,
+		ExportedAt:     time.Now(),
+		ExportedBy:     exportedBy,
+		Messages:       messages,
+		Documents:      documents,
+	}, nil
+}
+
+func transcriptSpeaker(role string) string {
+	if role == MessageRoleAssistant {
+		return "Assistant"
+	}
+	return "User"
+}
+
+// Provider, template and intent details of an assistant message
+func transcriptMetadata(message ChatMessage) string {
+	var parts []string
+	if message.Provider != "" {
+		provider := "Provider: " + message.Provider
+		if message.Model != "" {
+			provider += " (" + message.Model + ")"
+		}
+		parts = append(parts, provider)
+	}
+	if message.PromptTemplateVersion > 0 {
+		parts = append(parts, fmt.Sprintf("Prompt template v%d", message.PromptTemplateVersion))
+	}
+	if message.Intent != "" {
+		parts = append(parts, "Intent: "+message.Intent)
+	}
+	return strings.Join(parts, " | ")
+}
+
+func transcriptOwner(t ConversationTranscript) string {
+	return fmt.Sprintf("%s %s (%s, %s)", t.Owner.FirstName, t.Owner.LastName, t.Owner.Username, t.Owner.Email)
+}
+
+func citationLine(citation Citation) string {
+	line := fmt.Sprintf("[%d] %s", citation.Marker, citation.DocumentName)
+	if snippet := strings.Join(strings.Fields(citation.Snippet), " "); snippet != "" {
+		line += fmt.Sprintf(": \"%s\"", snippet)
+	}
+	return line
+}
+
+func renderTranscriptMarkdown(t ConversationTranscript) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", t.Title)
+	fmt.Fprintf(&b, "- **Conversation:** %d\n", t.ConversationID)
+	fmt.Fprintf(&b, "- **User:** %s\n", transcriptOwner(t))
+	fmt.Fprintf(&b, "- **Started:** %s\n", t.StartedAt.UTC().Format(transcriptTimeFormat))
+	fmt.Fprintf(&b, "- **Last activity:** %s\n", t.LastActivityAt.UTC().Format(transcriptTimeFormat))
+	fmt.Fprintf(&b, "- **Exported:** %s by %s\n", t.ExportedAt.UTC().Format(transcriptTimeFormat), t.ExportedBy)
+
+	for _, message := range t.Messages {
+		fmt.Fprintf(&b, "\n---\n\n### %s - %s\n\n", transcriptSpeaker(message.Role), message.CreatedAt.UTC().Format(transcriptTimeFormat))
+		fmt.Fprintf(&b, "%s\n", strings.TrimSpace(message.Content))
+
+		if message.Role != MessageRoleAssistant {
+			continue
+		}
+		if metadata := transcriptMetadata(message); metadata != "" {
+			fmt.Fprintf(&b, "\n*%s*\n", metadata)
+		}
+		if len(message.Citations) > 0 {
+			b.WriteString("\n**Sources**\n\n")
+			for _, citation := range message.Citations {
+				fmt.Fprintf(&b, "- %s\n", citationLine(citation))
+			}
+		}
+	}
+
+	if len(t.Documents) > 0 {
+		b.WriteString("\n---\n\n## Cited documents\n\n")
+		for _, document := range t.Documents {
+			fmt.Fprintf(&b, "- %s (ID %d", document.Name, document.ID)
+			if document.CurrentVersion > 0 {
+				fmt.Fprintf(&b, ", current version %d", document.CurrentVersion)
+			} else {
+				b.WriteString(", no longer available")
+			}
+			fmt.Fprintf(&b, ") - cited %d times\n", document.Citations)
+		}
+	}
+	return []byte(b.String())
+}
+
+func renderTranscriptPDF(t ConversationTranscript) []byte {
+	pdf := newTextPDF(t.Title)
+	pdf.paragraph(t.Title, pdfFontBold, 16, 0)
+	pdf.space(4)
+	for _, line := range []string{
+		fmt.Sprintf("Conversation: %d", t.ConversationID),
+		"User: " + transcriptOwner(t),
+		"Started: " + t.StartedAt.UTC().Format(transcriptTimeFormat),
+		"Last activity: " + t.LastActivityAt.UTC().Format(transcriptTimeFormat),
+		fmt.Sprintf("Exported: %s by %s", t.ExportedAt.UTC().Format(transcriptTimeFormat), t.ExportedBy),
+	} {
+		pdf.paragraph(line, pdfFontRegular, 10, 0)
+	}
+
+	for _, message := range t.Messages {
+		pdf.rule()
+		pdf.paragraph(fmt.Sprintf("%s - %s", transcriptSpeaker(message.Role), message.CreatedAt.UTC().Format(transcriptTimeFormat)), pdfFontBold, 11, 0)
+		pdf.space(2)
+		pdf.paragraph(strings.TrimSpace(message.Content), pdfFontRegular, 10, 0)
+
+		if message.Role != MessageRoleAssistant {
+			continue
+		}
+		if metadata := transcriptMetadata(message); metadata != "" {
+			pdf.space(2)
+			pdf.paragraph(metadata, pdfFontRegular, 8, 0)
+		}
+		if len(message.Citations) > 0 {
+			pdf.space(2)
+			pdf.paragraph("Sources", pdfFontBold, 9, 0)
+			for _, citation := range message.Citations {
+				pdf.paragraph(citationLine(citation), pdfFontRegular, 9, 12)
+			}
+		}
+	}
+
+	if len(t.Documents) > 0 {
+		pdf.rule()
+		pdf.paragraph("Cited documents", pdfFontBold, 12, 0)
+		for _, document := range t.Documents {
+			version := "no longer available"
+			if document.CurrentVersion > 0 {
+				version = fmt.Sprintf("current version %d", document.CurrentVersion)
+			}
+			pdf.paragraph(fmt.Sprintf("%s (ID %d, %s) - cited %d times", document.Name, document.ID, version, document.Citations), pdfFontRegular, 10, 12)
+		}
+	}
+	return pdf.Bytes()
+}
+
+// Transcript handlers
+
+// Export a conversation as Markdown, JSON or PDF (?format=). Users export their own
+// conversations; admins can export any user's, and every export is audit-logged.
+func handleExportConversation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+	format, ok := transcriptFormat(c.Query("format"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be markdown, json or pdf"})
+		return
+	}
+
+	user := currentUser(c)
+	query := db.Preload("Messages", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("created_at ASC, id ASC")
+	}).Where("id = ?", id)
+	if !canExportAnyTranscript(c) {
+		query = query.Where("user_id = ?", user.ID)
+	}
+
+	var conversation Conversation
+	if err := query.First(&conversation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation"})
+		}
+		return
+	}
+
+	transcript, err := buildTranscript(conversation, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build transcript"})
+		return
+	}
+
+	details := fmt.Sprintf("Exported conversation %d (%d messages) as %s", conversation.ID, len(transcript.Messages), format)
+	if conversation.UserID != user.ID {
+		details += fmt.Sprintf(" on behalf of another user: %s", transcript.Owner.Username)
+	}
+	logAuditActivity(c, user.ID, ActionExport, ResourceConversation, &conversation.ID, conversation.Title, details)
+
+	filename := fmt.Sprintf("conversation-%d", conversation.ID)
+	switch format {
+	case TranscriptJSON:
+		body, err := json.MarshalIndent(transcript, "", "  ")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render transcript"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", filename))
+		c.Data(http.StatusOK, "application/json", body)
+	case TranscriptPDF:
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", filename))
+		c.Data(http.StatusOK, "application/pdf", renderTranscriptPDF(transcript))
+	default:
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.md\"", filename))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", renderTranscriptMarkdown(transcript))
+	}
+}
+
+// List another user's conversations so they can be exported (Admin only)
+func handleGetUserConversations(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var conversations []Conversation
+	if err := db.Where("user_id = ?", userID).Order("updated_at DESC").Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	ownerID := uint(userID)
+	logAuditActivity(c, adminID.(uint), ActionView, ResourceUser, &ownerID, "",
+		fmt.Sprintf("Listed %d conversations of user %d", len(conversations), ownerID))
+
+	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
+}
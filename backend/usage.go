@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LLMUsage model for a user's LLM consumption on one day (UTC) with one provider
+type LLMUsage struct {
+	ID               uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID           uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_usage_user_date_provider"`
+	Date             string    `json:"date" gorm:"not null;size:10;uniqueIndex:idx_usage_user_date_provider;index"` // YYYY-MM-DD
+	Provider         string    `json:"provider" gorm:"not null;size:50;uniqueIndex:idx_usage_user_date_provider"`
+	Requests         int       `json:"requests" gorm:"not null;default:0"`
+	PromptTokens     int       `json:"prompt_tokens" gorm:"not null;default:0"`
+	CompletionTokens int       `json:"completion_tokens" gorm:"not null;default:0"`
+	EstimatedTokens  int       `json:"estimated_tokens" gorm:"not null;default:0"` // Part of the totals that was estimated, not reported by the provider
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// ChatLimits holds the rate limit and token quota for a role. Zero disables a limit.
+type ChatLimits struct {
+	Requests    int           `json:"requests"` // Chat requests allowed per window
+	Window      time.Duration `json:"-"`
+	DailyTokens int           `json:"daily_tokens"` // Prompt plus completion tokens per UTC day
+}
+
+// Load the limits for a role. CHAT_<SETTING>_<ROLE> overrides CHAT_<SETTING>,
+// e.g. CHAT_DAILY_TOKENS_ADMIN=0 lifts the token quota for admins.
+func loadChatLimits(role string) ChatLimits {
+	suffix := "_" + strings.ToUpper(role)
+	return ChatLimits{
+		Requests:    getEnvInt("CHAT_RATE_LIMIT"+suffix, getEnvInt("CHAT_RATE_LIMIT", 20)),
+		Window:      getEnvDuration("CHAT_RATE_WINDOW"+suffix, getEnvDuration("CHAT_RATE_WINDOW", time.Minute)),
+		DailyTokens: getEnvInt("CHAT_DAILY_TOKENS"+suffix, getEnvInt("CHAT_DAILY_TOKENS", 100000)),
+	}
+}
+
+// Sliding-window request limiter keyed by user
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests map[uint][]time.Time
+}
+
+var chatRateLimiter = &rateLimiter{requests: make(map[uint][]time.Time)}
+
+// Allow records a request if the user is under the limit. Otherwise it returns
+// how long until the oldest request in the window expires.
+func (rl *rateLimiter) Allow(userID uint, limit int, window time.Duration) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	recent := rl.requests[userID][:0]
+	for _, at := range rl.requests[userID] {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+
+	if len(recent) >= limit {
+		rl.requests[userID] = recent
+		return false, 0, window - now.Sub(recent[0])
+	}
+
+	rl.requests[userID] = append(recent, now)
+	return true, limit - len(recent) - 1, 0
+}
+
+func usageDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// Time until the daily quota resets at midnight UTC
+func untilQuotaReset() time.Duration {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
+
+// Tokens a user has used today, across providers
+func tokensUsedToday(userID uint) (int, error) {
+	var used int
+	err := db.Model(&LLMUsage{}).Where("user_id = ? AND date = ?", userID, usageDate(time.Now())).
+		Select("COALESCE(SUM(prompt_tokens + completion_tokens), 0)").Scan(&used).Error
+	return used, err
+}
+
+// Reject a request with 429 and a Retry-After hint
+func abortTooManyRequests(c *gin.Context, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+		"retry_at":    time.Now().Add(time.Duration(seconds) * time.Second).UTC(),
+	})
+	c.Abort()
+}
+
+// Rate limit and token quota middleware for chat routes, used after authMiddleware
+func chatLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		role, _ := c.Get("user_role")
+		uid := userID.(uint)
+		limits := loadChatLimits(role.(string))
+
+		if limits.Requests > 0 && limits.Window > 0 {
+			allowed, remaining, retryAfter := chatRateLimiter.Allow(uid, limits.Requests, limits.Window)
+			c.Header("X-RateLimit-Limit", strconv.Itoa(limits.Requests))
+			if !allowed {
+				c.Header("X-RateLimit-Remaining", "0")
+				log.Printf("⏳ Chat rate limit reached for user %d (%d per %s)", uid, limits.Requests, limits.Window)
+				abortTooManyRequests(c, fmt.Sprintf("Rate limit exceeded: %d chat requests per %s", limits.Requests, limits.Window), retryAfter)
+				return
+			}
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		}
+
+		if limits.DailyTokens > 0 {
+			used, err := tokensUsedToday(uid)
+			if err != nil {
+				// Accounting problems must not lock everyone out of the chatbot
+				log.Printf("Failed to check token quota for user %d: %v", uid, err)
+			} else if used >= limits.DailyTokens {
+				logSystemActivity(c, uid, ActionBlock, fmt.Sprintf("Daily LLM token quota reached (%d/%d tokens)", used, limits.DailyTokens))
+				abortTooManyRequests(c, fmt.Sprintf("Daily token quota of %d tokens reached", limits.DailyTokens), untilQuotaReset())
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// Record the tokens of an LLM answer against a user. Providers that do not report
+// usage are estimated from the prompt and answer text. The mock provider is free.
+func recordLLMUsage(userID uint, req LLMRequest, response *LLMResponse) {
+	if response == nil || response.Provider == "" || response.Provider == ProviderMock {
+		return
+	}
+
+	usage := LLMUsage{
+		UserID:           userID,
+		Date:             usageDate(time.Now()),
+		Provider:         response.Provider,
+		Requests:         1,
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = estimateTokens(req.System) + estimateTokens(req.Prompt)
+		usage.EstimatedTokens += usage.PromptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens = estimateTokens(response.Text)
+		usage.EstimatedTokens += usage.CompletionTokens
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "date"}, {Name: "provider"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":          gorm.Expr("llm_usages.requests + ?", usage.Requests),
+			"prompt_tokens":     gorm.Expr("llm_usages.prompt_tokens + ?", usage.PromptTokens),
+			"completion_tokens": gorm.Expr("llm_usages.completion_tokens + ?", usage.CompletionTokens),
+			"estimated_tokens":  gorm.Expr("llm_usages.estimated_tokens + ?", usage.EstimatedTokens),
+			"updated_at":        time.Now(),
+		}),
+	}).Create(&usage).Error
+	if err != nil {
+		log.Printf("Failed to record LLM usage for user %d: %v", userID, err)
+	}
+}
+
+// Usage handlers
+
+// Aggregated usage row for the admin report
+type UsageTotals struct {
+	Key              string `json:"key"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	EstimatedTokens  int    `json:"estimated_tokens"`
+}
+
+// Per-user row of the admin report
+type UserUsage struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	UsageTotals
+}
+
+// Current user's usage today against their limits
+func handleGetMyUsage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("user_role")
+	limits := loadChatLimits(role.(string))
+
+	var usage []LLMUsage
+	if err := db.Where("user_id = ? AND date = ?", userID, usageDate(time.Now())).Find(&usage).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	today := UsageTotals{Key: usageDate(time.Now())}
+	for _, row := range usage {
+		today.add(row)
+	}
+
+	quota := gin.H{"daily_tokens": limits.DailyTokens, "resets_in": int(untilQuotaReset().Seconds())}
+	if limits.DailyTokens > 0 {
+		remaining := limits.DailyTokens - today.TotalTokens
+		if remaining < 0 {
+			remaining = 0
+		}
+		quota["remaining_tokens"] = remaining
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"today":       today,
+		"by_provider": usage,
+		"quota":       quota,
+		"rate_limit":  gin.H{"requests": limits.Requests, "window_seconds": int(limits.Window.Seconds())},
+	})
+}
+
+// Usage report across users, days and providers (Admin only)
+func handleGetUsageReport(c *gin.Context) {
+	to := usageDate(time.Now())
+	from := usageDate(time.Now().AddDate(0, 0, -29))
+	if value := c.Query("from"); value != "" {
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD"})
+			return
+		}
+		from = value
+	}
+	if value := c.Query("to"); value != "" {
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD"})
+			return
+		}
+		to = value
+	}
+
+	query := db.Model(&LLMUsage{}).Where("date >= ? AND date <= ?", from, to)
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if provider := c.Query("provider"); provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+
+	var usage []LLMUsage
+	if err := query.Order("date ASC").Find(&usage).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	totals := UsageTotals{Key: "all"}
+	byDay := make(map[string]*UsageTotals)
+	byProvider := make(map[string]*UsageTotals)
+	byUser := make(map[uint]*UsageTotals)
+	var days, providers []string
+	var userIDs []uint
+
+	for _, row := range usage {
+		totals.add(row)
+		if byDay[row.Date] == nil {
+			byDay[row.Date] = &UsageTotals{Key: row.Date}
+			days = append(days, row.Date)
+		}
+		byDay[row.Date].add(row)
+		if byProvider[row.Provider] == nil {
+			byProvider[row.Provider] = &UsageTotals{Key: row.Provider}
+			providers = append(providers, row.Provider)
+		}
+		byProvider[row.Provider].add(row)
+		if byUser[row.UserID] == nil {
+			byUser[row.UserID] = &UsageTotals{Key: strconv.FormatUint(uint64(row.UserID), 10)}
+			userIDs = append(userIDs, row.UserID)
+		}
+		byUser[row.UserID].add(row)
+	}
+
+	var users []User
+	if len(userIDs) > 0 {
+		db.Where("id IN ?", userIDs).Find(&users)
+	}
+	userByID := make(map[uint]User)
+	for _, user := range users {
+		userByID[user.ID] = user
+	}
+
+	var userRows []UserUsage
+	for _, id := range userIDs {
+		userRows = append(userRows, UserUsage{
+			UserID:      id,
+			Username:    userByID[id].Username,
+			Role:        userByID[id].Role,
+			UsageTotals: *byUser[id],
+		})
+	}
+	// Heaviest users first
+	sort.SliceStable(userRows, func(i, j int) bool {
+		return userRows[i].TotalTokens > userRows[j].TotalTokens
+	})
+
+	var dayRows, providerRows []UsageTotals
+	for _, day := range days {
+		dayRows = append(dayRows, *byDay[day])
+	}
+	for _, provider := range providers {
+		providerRows = append(providerRows, *byProvider[provider])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from,
+		"to":          to,
+		"totals":      totals,
+		"by_user":     userRows,
+		"by_day":      dayRows,
+		"by_provider": providerRows,
+	})
+}
+
+func (t *UsageTotals) add(row LLMUsage) {
+	t.Requests += row.Requests
+	t.PromptTokens += row.PromptTokens
+	t.CompletionTokens += row.CompletionTokens
+	t.TotalTokens += row.PromptTokens + row.CompletionTokens
+	t.EstimatedTokens += row.EstimatedTokens
+}
@@ -1,3 +1,5 @@
+import type { User } from './api';
+
 export interface ChatMessage {
   id: string;
   content: string;
@@ -20,17 +22,149 @@ export interface PolicyFile {
   created_by: string;
   last_updated: string;
   is_active: boolean;
+  version: number;
+  requires_acknowledgement: boolean;
 }
 
+export type ChatIntent =
+  | 'policy_question'
+  | 'document_lookup'
+  | 'incident_report'
+  | 'onboarding_step'
+  | 'small_talk'
+  | 'out_of_scope';
+
 export interface ChatRequest {
   message: string;
-  type: 'onboarding' | 'policy_search';
+  type?: 'onboarding' | 'policy_search'; // Deprecated: the server classifies intent
+  conversation_id?: number;
+}
+
+// Policy passage that was given to the LLM when answering
+export interface ChatSource {
+  document_id: number;
+  document_name: string;
+  chunk_index: number;
+  start: number;
+  end: number;
+  score: number;
+}
+
+// Inline citation backing a claim in a chat answer
+export interface Citation {
+  marker: number;
+  document_id: number;
+  document_name: string;
+  chunk_index: number;
+  start: number;
+  end: number;
+  snippet: string;
+  claim?: string;
+  inferred?: boolean;
+}
+
+// Prompt template version that produced a chat answer
+export interface PromptTemplateRef {
+  id?: number;
+  name: string;
+  version: number;
 }
 
 export interface ChatResponse {
   response: string;
   type: string;
+  conversation_id?: number;
+  message_id?: number;
+  provider?: string;
+  model?: string;
+  cached?: boolean;
+  intent?: ChatIntent;
+  intent_confidence: number;
+  prompt_template?: PromptTemplateRef;
   policy_files?: PolicyFile[];
+  sources?: ChatSource[];
+  citations?: Citation[];
+  incident?: Incident; // Incident filed from the message
+}
+
+// Persisted conversation and its messages
+export interface ConversationMessage {
+  id: number;
+  conversation_id: number;
+  role: 'user' | 'assistant';
+  content: string;
+  type?: string;
+  intent?: ChatIntent;
+  provider?: string;
+  model?: string;
+  prompt_template_id?: number;
+  prompt_template_version?: number;
+  sources?: ChatSource[];
+  citations?: Citation[];
+  document_ids?: number[]; // Documents the answer drew on or returned
+  created_at: string;
+}
+
+// Rating of an assistant answer
+export type FeedbackRating = 'up' | 'down';
+
+export type FeedbackReason =
+  | 'helpful'
+  | 'inaccurate'
+  | 'incomplete'
+  | 'irrelevant'
+  | 'outdated'
+  | 'unclear'
+  | 'bad_citation'
+  | 'other';
+
+export interface ChatFeedbackRequest {
+  rating: FeedbackRating;
+  reason?: FeedbackReason;
+  comment?: string;
+}
+
+export interface ChatFeedback {
+  id: number;
+  message_id: number;
+  conversation_id: number;
+  user_id: number;
+  rating: FeedbackRating;
+  reason?: FeedbackReason;
+  comment?: string;
+  question?: string;
+  topic: string;
+  provider?: string;
+  model?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+// Aggregated ratings for a topic, document or provider (admin report)
+export interface FeedbackStat {
+  key: string;
+  label: string;
+  up: number;
+  down: number;
+  total: number;
+  satisfaction: number;
+  reasons?: { [reason: string]: number };
+}
+
+export interface FeedbackReport {
+  totals: FeedbackStat;
+  by_topic: FeedbackStat[];
+  by_document: FeedbackStat[];
+  by_provider: FeedbackStat[];
+}
+
+export interface Conversation {
+  id: number;
+  user_id: number;
+  title: string;
+  messages?: ConversationMessage[];
+  created_at: string;
+  updated_at: string;
 }
 
 export type ChatMode = 'onboarding' | 'policy_search';
@@ -45,6 +179,7 @@ export interface CreateDocumentRequest {
   tags: string[];
   created_by?: string;
   file_path?: string;
+  requires_acknowledgement?: boolean;
 }
 
 export interface UpdateDocumentRequest {
@@ -55,6 +190,7 @@ export interface UpdateDocumentRequest {
   document_type?: 'policy' | 'onboarding';
   tags?: string[];
   is_active?: boolean;
+  requires_acknowledgement?: boolean;
 }
 
 export interface DocumentSearchParams {
@@ -76,4 +212,399 @@ export interface DocumentStats {
   policies: number;
   onboardingDocs: number;
   categories: { [key: string]: number };
-} 
\ No newline at end of file
+} 
+// LLM token usage and limits
+export interface UsageTotals {
+  key: string;
+  requests: number;
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+  estimated_tokens: number;
+}
+
+export interface MyUsage {
+  today: UsageTotals;
+  quota: {
+    daily_tokens: number;
+    remaining_tokens?: number;
+    resets_in: number;
+  };
+  rate_limit: {
+    requests: number;
+    window_seconds: number;
+  };
+}
+
+// Body of a 429 response from the chat endpoints
+export interface RateLimitError {
+  error: string;
+  retry_after: number;
+  retry_at: string;
+}
+
+export interface AnswerCacheStats {
+  entries: number;
+  hits: number;
+  semantic_hits: number;
+  misses: number;
+  hit_rate: number;
+  stores: number;
+  invalidations: number;
+  expirations: number;
+  evictions: number;
+}
+
+export interface AnswerCacheStatus {
+  enabled: boolean;
+  ttl_seconds: number;
+  max_entries: number;
+  similarity: number;
+  stats: AnswerCacheStats;
+}
+
+export interface MatchSpan {
+  start: number; // Character offsets into the field text
+  end: number;
+  text: string;
+}
+
+export interface SearchMatch {
+  field: 'name' | 'description' | 'content' | 'category' | 'tags';
+  text: string;
+  score: number;
+  span?: MatchSpan; // Phrase matches and query terms found close together
+}
+
+export interface SnippetRange {
+  start: number;
+  end: number;
+}
+
+export interface SearchSnippet {
+  field: 'content' | 'description';
+  text: string; // Matched words wrapped in the highlight markers (<mark> by default, HTML-escaped)
+  start: number; // Character offsets of the excerpt in the field text
+  end: number;
+  highlights: SnippetRange[]; // Character offsets of the highlighted words in the field text
+}
+
+export interface DocumentMatch {
+  document: PolicyFile;
+  score: number;
+  matches: SearchMatch[];
+  snippets?: SearchSnippet[];
+}
+
+export interface SearchIndexStats {
+  documents: number;
+  terms: number;
+  postings: number;
+  rebuilds: number;
+  last_rebuild_at?: string;
+  rebuild_duration_ms: number;
+  updates: number; // Single documents added, reindexed or removed since startup
+  last_update_at?: string;
+  average_field_lengths: Record<string, number>; // Words per document, used for length normalization
+}
+
+export interface OnboardingStep {
+  id: number;
+  program_id: number;
+  position: number;
+  title: string;
+  description: string;
+  document_id?: number;
+  document?: PolicyFile;
+  quiz_id?: number;
+  due_offset_days: number;
+  required_roles: string[];
+  created_at: string;
+  updated_at: string;
+}
+
+export interface OnboardingProgram {
+  id: number;
+  name: string;
+  description: string;
+  roles: string[];
+  steps?: OnboardingStep[];
+  is_active: boolean;
+  created_by: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface OnboardingStepStatus extends OnboardingStep {
+  required: boolean;
+  due_date: string;
+  completed_at?: string;
+  overdue: boolean;
+}
+
+export interface OnboardingStatus {
+  assignment_id: number;
+  program_id: number;
+  program_name: string;
+  description?: string;
+  hire_date: string;
+  assigned_at: string;
+  completed_at?: string;
+  steps: OnboardingStepStatus[];
+  required_steps: number;
+  completed_required: number;
+  completed_steps: number;
+  overdue_steps: number;
+  progress: number;
+  next_step?: OnboardingStepStatus;
+}
+
+export interface MyOnboarding {
+  programs: OnboardingStatus[];
+  next_step: OnboardingStepStatus | null;
+}
+
+export interface OnboardingProgramRequest {
+  name: string;
+  description?: string;
+  roles?: string[];
+  is_active?: boolean;
+  steps: {
+    id?: number;
+    title: string;
+    description?: string;
+    document_id?: number;
+    quiz_id?: number;
+    due_offset_days: number;
+    required_roles?: string[];
+  }[];
+}
+
+export interface UserOnboardingProgress extends OnboardingStatus {
+  user: User;
+}
+
+export type AcknowledgementStatus = 'acknowledged' | 'outdated' | 'pending';
+
+export interface PolicyAcknowledgement {
+  id: number;
+  user_id: number;
+  document_id: number;
+  document_version: number;
+  content_hash: string;
+  ip_address?: string;
+  user_agent?: string;
+  acknowledged_at: string;
+}
+
+export interface PolicyAcknowledgementStatus {
+  document_id: number;
+  document_name: string;
+  category: string;
+  current_version: number;
+  status: AcknowledgementStatus;
+  acknowledged_version?: number;
+  acknowledged_at?: string;
+}
+
+export interface MyAcknowledgements {
+  policies: PolicyAcknowledgementStatus[];
+  outstanding: number;
+}
+
+export interface AcknowledgementUser extends User {
+  status: AcknowledgementStatus;
+  acknowledged_version?: number;
+  acknowledged_at?: string;
+}
+
+export interface PolicyAcknowledgementReport {
+  document_id: number;
+  document_name: string;
+  current_version: number;
+  updated_at: string;
+  acknowledged: AcknowledgementUser[];
+  outstanding: AcknowledgementUser[];
+  total_users: number;
+  completion: number;
+}
+
+export interface QuizQuestion {
+  id: number;
+  quiz_id: number;
+  position: number;
+  question: string;
+  options: string[];
+  correct_option: number; // -1 when the answer key is hidden
+  explanation?: string;
+  created_at: string;
+}
+
+export interface Quiz {
+  id: number;
+  document_id: number;
+  document_version: number;
+  title: string;
+  description: string;
+  pass_threshold: number;
+  max_attempts: number;
+  is_published: boolean;
+  is_active: boolean;
+  generated_by?: string;
+  created_by: string;
+  questions?: QuizQuestion[];
+  created_at: string;
+  updated_at: string;
+}
+
+export interface QuizAttempt {
+  id: number;
+  quiz_id: number;
+  user_id: number;
+  answers: number[];
+  correct: number;
+  total: number;
+  score: number;
+  passed: boolean;
+  document_version: number;
+  reset_at?: string; // Reset by an admin; no longer counts toward max_attempts
+  created_at: string;
+}
+
+export interface QuizSummary extends Quiz {
+  document_name: string;
+  outdated: boolean;
+  attempts: number;
+  best_attempt?: QuizAttempt;
+}
+
+export interface QuizRequest {
+  document_id: number;
+  title: string;
+  description?: string;
+  pass_threshold?: number;
+  max_attempts?: number;
+  is_published?: boolean;
+  questions: {
+    question: string;
+    options: string[];
+    correct_option: number;
+    explanation?: string;
+  }[];
+}
+
+export interface DraftQuizRequest {
+  document_id: number;
+  question_count?: number;
+}
+
+export interface QuizAnswerResult {
+  question_id: number;
+  chosen: number;
+  correct_option: number;
+  correct: boolean;
+  explanation?: string;
+}
+
+export interface QuizAttemptResult {
+  attempt: QuizAttempt;
+  results: QuizAnswerResult[];
+}
+
+export type IncidentType =
+  | 'phishing'
+  | 'malware'
+  | 'lost_device'
+  | 'account_compromise'
+  | 'data_leak'
+  | 'unauthorized_access'
+  | 'other';
+
+export type IncidentSeverity = 'low' | 'medium' | 'high' | 'critical';
+
+export type IncidentStatus = 'open' | 'acknowledged' | 'investigating' | 'resolved' | 'closed';
+
+export interface IncidentHistory {
+  id: number;
+  incident_id: number;
+  actor_id: number;
+  actor: string;
+  action: 'reported' | 'status' | 'severity' | 'escalated' | 'assigned' | 'details';
+  from_value?: string;
+  to_value?: string;
+  note?: string;
+  created_at: string;
+}
+
+export interface Incident {
+  id: number;
+  reference: string;
+  reporter_id: number;
+  type: IncidentType;
+  description: string;
+  affected_assets: string[];
+  observed_at: string;
+  severity: IncidentSeverity;
+  escalation_level: 1 | 2 | 3; // L1 Help Desk, L2 Security Team, L3 CISO
+  assignee_role: string;
+  assignee_id?: number;
+  status: IncidentStatus;
+  source: 'chat' | 'api';
+  conversation_id?: number;
+  report_due_at: string;
+  reported_late: boolean;
+  acknowledge_due_at: string;
+  resolve_due_at: string;
+  acknowledged_at?: string;
+  resolved_at?: string;
+  closed_at?: string;
+  acknowledge_overdue: boolean;
+  resolution_overdue: boolean;
+  overdue: boolean;
+  history?: IncidentHistory[];
+  created_at: string;
+  updated_at: string;
+}
+
+export interface CreateIncidentRequest {
+  type: IncidentType;
+  description: string;
+  affected_assets?: string[];
+  observed_at?: string;
+  severity?: IncidentSeverity;
+}
+
+export interface UpdateIncidentRequest {
+  status?: IncidentStatus;
+  severity?: IncidentSeverity;
+  assignee_id?: number;
+  note?: string;
+}
+
+export interface IncidentList {
+  incidents: Incident[];
+  total: number;
+  overdue: number;
+}
+
+export type TranscriptFormat = 'markdown' | 'json' | 'pdf';
+
+export interface TranscriptDocument {
+  id: number;
+  name: string;
+  category?: string;
+  current_version?: number; // Absent when the document was deleted
+  citations: number;
+}
+
+export interface ConversationTranscript {
+  conversation_id: number;
+  title: string;
+  owner: User;
+  started_at: string;
+  last_activity_at: string;
+  exported_at: string;
+  exported_by: string;
+  messages: ConversationMessage[];
+  documents: TranscriptDocument[];
+}